@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/but80/fmfm.core/cmd/fmfm-cli/internal/player"
+	"github.com/urfave/cli"
+)
+
+// audioFlags は、オーディオデバイスに出力するコマンドに共通のオプションです。
+var audioFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "host-api, H",
+		Usage: `Host API of the audio output device (default: system default)`,
+	},
+	cli.StringFlag{
+		Name:  "audio-device, a",
+		Usage: `Audio output device (default: default device of the host API)`,
+	},
+	cli.IntFlag{
+		Name:  "buffer, b",
+		Usage: `Frames per buffer (0: unspecified)`,
+	},
+	cli.StringFlag{
+		Name:  "latency, L",
+		Usage: `Output latency ("low", "high" or milliseconds)`,
+		Value: "high",
+	},
+	cli.Float64Flag{
+		Name:  "midi-latency, M",
+		Usage: `Fixed delay in milliseconds added to the output latency before MIDI messages take effect`,
+		Value: float64(player.DefaultSchedulingLatency / time.Millisecond),
+	},
+}
+
+// schedulingLatency は、audioFlags に従ってMIDIメッセージのスケジューリング遅延を返します。
+func schedulingLatency(ctx *cli.Context) (time.Duration, error) {
+	ms := ctx.Float64("midi-latency")
+	if ms < 0 {
+		return 0, fmt.Errorf("invalid MIDI latency: %g", ms)
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// newAudioOutputOpts は、audioFlags に従って player.AudioOutputOpts を作成します。
+func newAudioOutputOpts(ctx *cli.Context) (*player.AudioOutputOpts, error) {
+	opts := &player.AudioOutputOpts{
+		HostAPI:         ctx.String("host-api"),
+		Device:          ctx.String("audio-device"),
+		FramesPerBuffer: ctx.Int("buffer"),
+	}
+	if opts.FramesPerBuffer < 0 {
+		return nil, fmt.Errorf("invalid buffer size: %d", opts.FramesPerBuffer)
+	}
+	switch latency := ctx.String("latency"); latency {
+	case "low":
+		opts.LowLatency = true
+	case "high", "":
+	default:
+		ms, err := strconv.ParseFloat(latency, 64)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("invalid latency: %s", latency)
+		}
+		opts.Latency = time.Duration(ms * float64(time.Millisecond))
+	}
+	return opts, nil
+}
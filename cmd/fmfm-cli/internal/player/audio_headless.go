@@ -0,0 +1,15 @@
+//go:build !cgo || headless
+// +build !cgo headless
+
+package player
+
+import "github.com/but80/fmfm.core/ymf"
+
+func openAudioOutput(opts *AudioOutputOpts, logger ymf.Logger) (AudioOutput, error) {
+	return nil, ErrNoDeviceSupport
+}
+
+// ListAudioDevices は、出力先として選択可能なオーディオデバイスの一覧を取得します。
+func ListAudioDevices() ([]AudioDeviceInfo, error) {
+	return nil, ErrNoDeviceSupport
+}
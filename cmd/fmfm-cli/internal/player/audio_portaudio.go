@@ -0,0 +1,176 @@
+//go:build cgo && !headless
+// +build cgo,!headless
+
+package player
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/gordonklaus/portaudio"
+)
+
+// portAudioOutput は、PortAudio によるオーディオデバイスへの出力です。
+type portAudioOutput struct {
+	parameters portaudio.StreamParameters
+	stream     *portaudio.Stream
+}
+
+var _ AudioOutput = &portAudioOutput{}
+
+func openAudioOutput(opts *AudioOutputOpts, logger ymf.Logger) (AudioOutput, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+
+	device, err := findOutputDevice(opts)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+	logger.Printf("Audio device: %s > %s", device.HostApi.Name, device.Name)
+
+	var parameters portaudio.StreamParameters
+	if opts.LowLatency {
+		parameters = portaudio.LowLatencyParameters(nil, device)
+	} else {
+		parameters = portaudio.HighLatencyParameters(nil, device)
+	}
+	if 0 < opts.Latency {
+		parameters.Output.Latency = opts.Latency
+	}
+	if 0 < opts.FramesPerBuffer {
+		parameters.FramesPerBuffer = opts.FramesPerBuffer
+	}
+	return &portAudioOutput{parameters: parameters}, nil
+}
+
+// findOutputDevice は、opts に従って出力先のオーディオデバイスを選択します。
+func findOutputDevice(opts *AudioOutputOpts) (*portaudio.DeviceInfo, error) {
+	var h *portaudio.HostApiInfo
+	if opts.HostAPI == "" {
+		var err error
+		h, err = portaudio.DefaultHostApi()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		apis, err := portaudio.HostApis()
+		if err != nil {
+			return nil, err
+		}
+		for _, api := range apis {
+			if strings.EqualFold(api.Name, opts.HostAPI) {
+				h = api
+				break
+			}
+		}
+		if h == nil {
+			return nil, fmt.Errorf("no such host API found: %s", opts.HostAPI)
+		}
+	}
+
+	if opts.Device == "" {
+		if h.DefaultOutputDevice == nil {
+			return nil, fmt.Errorf("no default audio output device found in %s", h.Name)
+		}
+		return h.DefaultOutputDevice, nil
+	}
+	for _, device := range h.Devices {
+		if 0 < device.MaxOutputChannels && device.Name == opts.Device {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no such audio output device found in %s: %s", h.Name, opts.Device)
+}
+
+// ListAudioDevices は、出力先として選択可能なオーディオデバイスの一覧を取得します。
+func ListAudioDevices() ([]AudioDeviceInfo, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+	defer portaudio.Terminate()
+
+	apis, err := portaudio.HostApis()
+	if err != nil {
+		return nil, err
+	}
+	result := []AudioDeviceInfo{}
+	for _, api := range apis {
+		for _, device := range api.Devices {
+			if device.MaxOutputChannels < 1 {
+				continue
+			}
+			result = append(result, AudioDeviceInfo{
+				HostAPI:     api.Name,
+				Name:        device.Name,
+				Channels:    device.MaxOutputChannels,
+				SampleRate:  device.DefaultSampleRate,
+				LowLatency:  device.DefaultLowOutputLatency,
+				HighLatency: device.DefaultHighOutputLatency,
+				Default:     device == api.DefaultOutputDevice,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (o *portAudioOutput) SampleRate() float64 {
+	return o.parameters.SampleRate
+}
+
+func (o *portAudioOutput) Latency() time.Duration {
+	if o.stream == nil {
+		return 0
+	}
+	return o.stream.Info().OutputLatency
+}
+
+func (o *portAudioOutput) Time() time.Duration {
+	if o.stream == nil {
+		return 0
+	}
+	return o.stream.Time()
+}
+
+func (o *portAudioOutput) Start(callback func(out [][]float32, outputTime time.Duration)) error {
+	// コールバックから Latency および Time を参照できるよう、開始前に o.stream を設定する
+	var err error
+	o.stream, err = portaudio.OpenStream(o.parameters, func(out [][]float32, timeInfo portaudio.StreamCallbackTimeInfo) {
+		outputTime := timeInfo.OutputBufferDacTime
+		if outputTime == 0 {
+			// DAC の時刻を提供しないホストAPIでは、現在時刻と出力の遅延から推定する
+			outputTime = timeInfo.CurrentTime + o.Latency()
+		}
+		callback(out, outputTime)
+	})
+	if err != nil {
+		o.stream = nil
+		return err
+	}
+	if err := o.stream.Start(); err != nil {
+		o.stream.Close()
+		o.stream = nil
+		return err
+	}
+	return nil
+}
+
+func (o *portAudioOutput) Close() error {
+	var result error
+	if o.stream != nil {
+		if err := o.stream.Stop(); err != nil {
+			result = err
+		}
+		if err := o.stream.Close(); err != nil && result == nil {
+			result = err
+		}
+		o.stream = nil
+	}
+	if err := portaudio.Terminate(); err != nil && result == nil {
+		result = err
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package player
+
+import (
+	"math"
+)
+
+// Chorus は、センドエフェクト「コーラス」です。
+// 左右で位相の異なる LFO により遅延時間を揺らした、原音の遅延音を生成します。
+// センドエフェクトとして使用するため、Next は原音を含まない遅延音のみを返します。
+type Chorus struct {
+	sampleRate float64
+	delay      float64
+	depth      float64
+	phase      float64
+	phaseDelta float64
+	level      float64
+	buffer     [2][]float64
+	pos        int
+}
+
+var _ Insertion = &Chorus{}
+
+// chorusMaxDelay は、遅延時間と揺らす幅の和の上限 [秒] です。
+const chorusMaxDelay = .05
+
+// NewChorus は、新しい Chorus を作成します。
+func NewChorus(sampleRate float64) *Chorus {
+	ch := &Chorus{
+		sampleRate: sampleRate,
+	}
+	n := int(math.Ceil(sampleRate*chorusMaxDelay)) + 2
+	for i := range ch.buffer {
+		ch.buffer[i] = make([]float64, n)
+	}
+	return ch.SetDelay(.015).SetDepth(.003).SetRate(.5).SetLevel(.0)
+}
+
+// SetDelay は、遅延時間の中心 [秒] を設定します。
+func (ch *Chorus) SetDelay(sec float64) *Chorus {
+	ch.delay = math.Max(.0, math.Min(chorusMaxDelay, sec)) * ch.sampleRate
+	return ch
+}
+
+// SetDepth は、遅延時間を揺らす幅 [秒] を設定します。
+func (ch *Chorus) SetDepth(sec float64) *Chorus {
+	ch.depth = math.Max(.0, math.Min(chorusMaxDelay, sec)) * ch.sampleRate
+	return ch
+}
+
+// SetRate は、遅延時間を揺らす周期の逆数 [Hz] を設定します。
+func (ch *Chorus) SetRate(hz float64) *Chorus {
+	ch.phaseDelta = 2.0 * math.Pi * hz / ch.sampleRate
+	return ch
+}
+
+// SetLevel は、遅延音の出力レベル [dB] を設定します。
+func (ch *Chorus) SetLevel(v float64) *Chorus {
+	ch.level = math.Pow(10, v/20.0)
+	return ch
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (ch *Chorus) Next(l, r float64) (float64, float64) {
+	n := len(ch.buffer[0])
+	ch.buffer[0][ch.pos] = l
+	ch.buffer[1][ch.pos] = r
+
+	var out [2]float64
+	for i := range out {
+		// 右チャンネルは LFO の位相を 90度ずらす
+		d := ch.delay + ch.depth*math.Sin(ch.phase+float64(i)*math.Pi*.5)
+		d = math.Max(.0, math.Min(float64(n-2), d))
+		p := float64(ch.pos) - d
+		if p < 0 {
+			p += float64(n)
+		}
+		j := int(p)
+		f := p - float64(j)
+		out[i] = ch.buffer[i][j]*(1.0-f) + ch.buffer[i][(j+1)%n]*f
+	}
+
+	ch.pos = (ch.pos + 1) % n
+	ch.phase += ch.phaseDelta
+	if 2.0*math.Pi <= ch.phase {
+		ch.phase -= 2.0 * math.Pi
+	}
+	return out[0] * ch.level, out[1] * ch.level
+}
@@ -0,0 +1,27 @@
+package player
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoDeviceSupport は、オーディオデバイスおよびMIDIデバイスに対応しないビルドであることを表すエラーです。
+// cgo が無効な場合や headless タグを指定した場合、PortAudio と PortMIDI はリンクされず、
+// NewRenderer, NewSequencer, ListMIDIDeivces はこのエラーを返します。
+var ErrNoDeviceSupport = errors.New("audio and MIDI devices are not supported in this build")
+
+// AudioDeviceInfo は、出力先として選択可能なオーディオデバイスの情報です。
+type AudioDeviceInfo struct {
+	// HostAPI は、デバイスが属するホストAPIの名前です。
+	HostAPI string
+	// Name は、デバイスの名前です。
+	Name string
+	// Channels は、出力チャンネル数の最大値です。
+	Channels int
+	// SampleRate は、既定のサンプルレートです。
+	SampleRate float64
+	// LowLatency, HighLatency は、既定の低遅延および高遅延の設定における出力の遅延です。
+	LowLatency, HighLatency time.Duration
+	// Default は、ホストAPIの既定の出力デバイスであるかどうかです。
+	Default bool
+}
@@ -0,0 +1,104 @@
+package player
+
+import (
+	"math"
+
+	"github.com/but80/fmfm.core/effect"
+)
+
+// Handset は、インサーションエフェクト「ハンドセット」です。
+// 2000年代半ばの携帯電話の小型スピーカーを模して、狭い周波数特性、スピーカーの共振、
+// 大音量時の歪み、およびモノラル化と DAC の量子化を再現します。
+type Handset struct {
+	sampleRate float64
+	highPass   [2]effect.Biquad
+	lowPass    [2]effect.Biquad
+	resonance  effect.Biquad
+	drive      float64
+	mono       bool
+	steps      float64
+}
+
+var _ Insertion = &Handset{}
+
+// NewHandset は、新しい Handset を作成します。
+func NewHandset(sampleRate float64) *Handset {
+	h := &Handset{
+		sampleRate: sampleRate,
+	}
+	return h.SetHighPass(500).SetLowPass(6000).SetResonance(1200, 6, 1.5).SetDrive(6).SetMono(false).SetBits(0)
+}
+
+// SetHighPass は、低域の遮断周波数 [Hz] を設定します。
+func (h *Handset) SetHighPass(hz float64) *Handset {
+	// 4次のバターワース特性
+	h.highPass[0].SetHighPass(h.sampleRate, hz, .5412)
+	h.highPass[1].SetHighPass(h.sampleRate, hz, 1.3066)
+	return h
+}
+
+// SetLowPass は、高域の遮断周波数 [Hz] を設定します。
+func (h *Handset) SetLowPass(hz float64) *Handset {
+	// 4次のバターワース特性
+	h.lowPass[0].SetLowPass(h.sampleRate, hz, .5412)
+	h.lowPass[1].SetLowPass(h.sampleRate, hz, 1.3066)
+	return h
+}
+
+// SetResonance は、スピーカーの共振周波数 [Hz] と、その強調量 [dB] および Q を設定します。
+func (h *Handset) SetResonance(hz, gain, q float64) *Handset {
+	h.resonance.SetPeaking(h.sampleRate, hz, gain, q)
+	return h
+}
+
+// SetDrive は、歪みの強さ [dB] を設定します。
+// 小さな信号はそのまま通過し、振幅がおよそ -drive [dB] を超える信号は滑らかに飽和します。
+// 0 以下の場合は歪ませません。
+func (h *Handset) SetDrive(v float64) *Handset {
+	h.drive = 0
+	if 0 < v {
+		h.drive = math.Pow(10, v/20.0)
+	}
+	return h
+}
+
+// SetMono は、左右の信号を合算してモノラルにするかどうかを設定します。
+func (h *Handset) SetMono(v bool) *Handset {
+	h.mono = v
+	return h
+}
+
+// SetBits は、DAC の量子化ビット数を設定します。0 の場合は量子化しません。
+func (h *Handset) SetBits(n int) *Handset {
+	h.steps = 0
+	if 0 < n {
+		h.steps = math.Pow(2, float64(n-1))
+	}
+	return h
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (h *Handset) Next(l, r float64) (float64, float64) {
+	if h.mono {
+		l = (l + r) * .5
+		r = l
+	}
+	return h.process(0, l), h.process(1, r)
+}
+
+func (h *Handset) process(ch int, v float64) float64 {
+	for i := range h.highPass {
+		v = h.highPass[i].Process(ch, v)
+	}
+	v = h.resonance.Process(ch, v)
+	if 0 < h.drive {
+		v = math.Tanh(v*h.drive) / h.drive
+	}
+	for i := range h.lowPass {
+		v = h.lowPass[i].Process(ch, v)
+	}
+	if 0 < h.steps {
+		v = math.Max(-1.0, math.Min(1.0-1.0/h.steps, math.Floor(v*h.steps+.5)/h.steps))
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package player
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sinePeak は、振幅 amp, 周波数 hz の正弦波を ins に通し、定常状態での出力の最大振幅を返します。
+func sinePeak(ins Insertion, sampleRate, hz, amp float64) (float64, float64) {
+	var peakL, peakR float64
+	for i := 0; i < int(sampleRate); i++ {
+		v := amp * math.Sin(2.0*math.Pi*hz*float64(i)/sampleRate)
+		l, r := ins.Next(v, -v)
+		if sampleRate/2 <= float64(i) {
+			peakL = math.Max(peakL, math.Abs(l))
+			peakR = math.Max(peakR, math.Abs(r))
+		}
+	}
+	return peakL, peakR
+}
+
+func TestHandset(t *testing.T) {
+	low, _ := sinePeak(NewHandset(44100), 44100, 60, .1)
+	mid, _ := sinePeak(NewHandset(44100), 44100, 1200, .1)
+	high, _ := sinePeak(NewHandset(44100), 44100, 15000, .1)
+	assert.True(t, low < .01, "low frequency should be attenuated: %f", low)
+	assert.True(t, .1 < mid, "resonance should be emphasized: %f", mid)
+	assert.True(t, high < .01, "high frequency should be attenuated: %f", high)
+
+	loud, _ := sinePeak(NewHandset(44100).SetResonance(1200, 0, 1), 44100, 1200, 1)
+	assert.True(t, loud < .6, "loud signal should be saturated: %f", loud)
+
+	l, r := sinePeak(NewHandset(44100).SetMono(true), 44100, 1200, .1)
+	assert.Equal(t, .0, l)
+	assert.Equal(t, .0, r)
+
+	h := NewHandset(44100).SetBits(4)
+	for i := 0; i < 1000; i++ {
+		l, _ := h.Next(.3*math.Sin(float64(i)*.2), 0)
+		assert.Equal(t, l, math.Floor(l*8)/8)
+	}
+}
@@ -2,14 +2,22 @@ package player
 
 import (
 	"math"
+
+	"github.com/but80/fmfm.core/effect"
 )
 
 // Insertion は、インサーションエフェクトを抽象化したインタフェースです。
+// effect パッケージのエフェクトはこのインタフェースを満たします。
 type Insertion interface {
 	// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
 	Next(l, r float64) (float64, float64)
 }
 
+var (
+	_ Insertion = &effect.EQ{}
+	_ Insertion = &effect.Compressor{}
+)
+
 // Limiter は、インサーションエフェクト「リミッター」です。
 type Limiter struct {
 	sampleRate  float64
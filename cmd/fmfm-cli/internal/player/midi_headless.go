@@ -0,0 +1,15 @@
+//go:build !cgo || headless
+// +build !cgo headless
+
+package player
+
+import "github.com/but80/fmfm.core/ymf"
+
+func openMIDIInput(midiDevice string, logger ymf.Logger) (MIDIInput, error) {
+	return nil, ErrNoDeviceSupport
+}
+
+// ListMIDIDeivces は、入力として選択可能なMIDIデバイスの一覧を取得します。
+func ListMIDIDeivces() ([]string, error) {
+	return nil, ErrNoDeviceSupport
+}
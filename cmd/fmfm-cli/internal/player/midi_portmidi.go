@@ -0,0 +1,130 @@
+//go:build cgo && !headless
+// +build cgo,!headless
+
+package player
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/xlab/portmidi"
+)
+
+const defaultMIDIDeviceName = "IAC YAMAHA Virtual MIDI Device 0"
+
+var (
+	initPortMIDIOnce = sync.Once{}
+	initPortMIDIErr  error
+)
+
+func initPortMIDI() error {
+	initPortMIDIOnce.Do(func() {
+		initPortMIDIErr = portmidi.Initialize()
+	})
+	return initPortMIDIErr
+}
+
+// portMIDIInput は、PortMIDI によるMIDIデバイスからの受信です。
+type portMIDIInput struct {
+	stream *portmidi.Stream
+	events chan MIDIEvent
+}
+
+var _ MIDIInput = &portMIDIInput{}
+
+func openMIDIInput(midiDevice string, logger ymf.Logger) (MIDIInput, error) {
+	if midiDevice == "@" {
+		midiDevice = defaultMIDIDeviceName
+	}
+
+	if err := initPortMIDI(); err != nil {
+		return nil, err
+	}
+	if portmidi.CountDevices() < 1 {
+		return nil, ErrNoMIDIDevice
+	}
+
+	var selectedMIDIDeviceID portmidi.DeviceID
+
+	if midiDevice == "" {
+		var found bool
+		selectedMIDIDeviceID, found = portmidi.DefaultInputDeviceID()
+		if !found {
+			return nil, errors.New("no default MIDI device found")
+		}
+	} else {
+		var found bool
+		for i := 0; i < portmidi.CountDevices(); i++ {
+			deviceID := portmidi.DeviceID(i)
+			info := portmidi.GetDeviceInfo(deviceID)
+			if info.IsInputAvailable && info.Name == midiDevice {
+				selectedMIDIDeviceID = deviceID
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such MIDI device found: %s", midiDevice)
+		}
+	}
+
+	info := portmidi.GetDeviceInfo(selectedMIDIDeviceID)
+	logger.Printf("MIDI device: %s > %s", info.Interface, info.Name)
+
+	stream, err := portmidi.NewInputStream(selectedMIDIDeviceID, 512, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &portMIDIInput{
+		stream: stream,
+		events: make(chan MIDIEvent, 512),
+	}
+	go func() {
+		defer close(input.events)
+		for e := range stream.Source() {
+			if e.Timestamp < 0 {
+				continue
+			}
+			msg := portmidi.Message(e.Message)
+			input.events <- MIDIEvent{
+				Timestamp: int(e.Timestamp),
+				Status:    int(msg.Status()),
+				Data1:     int(msg.Data1()),
+				Data2:     int(msg.Data2()),
+			}
+		}
+	}()
+	return input, nil
+}
+
+func (in *portMIDIInput) Events() <-chan MIDIEvent {
+	return in.events
+}
+
+func (in *portMIDIInput) Time() time.Duration {
+	return time.Duration(portmidi.Time()) * time.Millisecond
+}
+
+func (in *portMIDIInput) Close() error {
+	return in.stream.Close()
+}
+
+// ListMIDIDeivces は、入力として選択可能なMIDIデバイスの一覧を取得します。
+func ListMIDIDeivces() ([]string, error) {
+	if err := initPortMIDI(); err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for i := 0; i < portmidi.CountDevices(); i++ {
+		deviceID := portmidi.DeviceID(i)
+		info := portmidi.GetDeviceInfo(deviceID)
+		if info.IsInputAvailable && info.Name != "" {
+			result = append(result, info.Name)
+		}
+	}
+	return result, nil
+}
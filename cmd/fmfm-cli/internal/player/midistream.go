@@ -0,0 +1,167 @@
+package player
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MIDIParser は、MIDIメッセージのバイト列を解析します。
+// ランニングステータスに対応し、システムメッセージは読み飛ばします。
+type MIDIParser struct {
+	status int
+	data   [2]int
+	n      int
+	skip   int
+	sysex  bool
+}
+
+// Feed は、1バイトを解析し、メッセージが完成した場合はそれを返します。
+// 返されるメッセージの Timestamp は 0 です。
+func (p *MIDIParser) Feed(b byte) (MIDIEvent, bool) {
+	v := int(b)
+	switch {
+	case 0xf8 <= v:
+		// リアルタイムメッセージはランニングステータスに影響しない
+		return MIDIEvent{}, false
+	case v == 0xf0:
+		p.status = 0
+		p.sysex = true
+		return MIDIEvent{}, false
+	case v == 0xf7:
+		p.status = 0
+		p.sysex = false
+		return MIDIEvent{}, false
+	case 0xf0 < v:
+		p.status = 0
+		p.sysex = false
+		switch v {
+		case 0xf1, 0xf3:
+			p.skip = 1
+		case 0xf2:
+			p.skip = 2
+		}
+		return MIDIEvent{}, false
+	case 0x80 <= v:
+		p.status = v
+		p.sysex = false
+		p.skip = 0
+		p.n = 0
+		return MIDIEvent{}, false
+	}
+
+	if p.sysex {
+		return MIDIEvent{}, false
+	}
+	if 0 < p.skip {
+		p.skip--
+		return MIDIEvent{}, false
+	}
+	if p.status == 0 {
+		return MIDIEvent{}, false
+	}
+	p.data[p.n] = v
+	p.n++
+	if p.n < p.dataLen() {
+		return MIDIEvent{}, false
+	}
+	p.n = 0
+	e := MIDIEvent{Status: p.status, Data1: p.data[0]}
+	if 1 < p.dataLen() {
+		e.Data2 = p.data[1]
+	}
+	return e, true
+}
+
+func (p *MIDIParser) dataLen() int {
+	switch p.status & 0xf0 {
+	case 0xc0, 0xd0:
+		return 1
+	}
+	return 2
+}
+
+// ParseMIDILine は、"<時刻[ms]> <16進数のバイト列>" 形式の1行を解析します。
+// 例えば "1500 90 3c 64" は、1.5秒後のMIDIチャンネル1のノートオンを表します。
+// 空行および # 以降はコメントとして無視され、その場合 ok は false となります。
+func ParseMIDILine(line string) (e MIDIEvent, ok bool, err error) {
+	if i := strings.IndexByte(line, '#'); 0 <= i {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return MIDIEvent{}, false, nil
+	}
+	timestamp, err := strconv.Atoi(fields[0])
+	if err != nil || timestamp < 0 {
+		return MIDIEvent{}, false, fmt.Errorf("invalid timestamp: %s", fields[0])
+	}
+	var p MIDIParser
+	for i, f := range fields[1:] {
+		b, err := strconv.ParseUint(f, 16, 8)
+		if err != nil {
+			return MIDIEvent{}, false, fmt.Errorf("invalid MIDI byte: %s", f)
+		}
+		if e, ok = p.Feed(byte(b)); ok {
+			if i != len(fields)-2 {
+				return MIDIEvent{}, false, fmt.Errorf("extra bytes after MIDI message: %s", line)
+			}
+			e.Timestamp = timestamp
+			return e, true, nil
+		}
+	}
+	return MIDIEvent{}, false, fmt.Errorf("incomplete MIDI message: %s", line)
+}
+
+// readerMIDIInput は、io.Reader から読み込んだMIDIメッセージのバイト列を受信する MIDIInput です。
+type readerMIDIInput struct {
+	events chan MIDIEvent
+	clock  func() int
+	err    error
+}
+
+// NewReaderMIDIInput は、r から読み込んだMIDIメッセージのバイト列を受信する MIDIInput を作成します。
+// 各メッセージの時刻は、メッセージが完成した時点の clock の値となります。
+// r が終端に達すると Events のチャンネルは閉じられます。
+func NewReaderMIDIInput(r io.Reader, clock func() int) MIDIInput {
+	in := &readerMIDIInput{
+		events: make(chan MIDIEvent, 512),
+		clock:  clock,
+	}
+	go func() {
+		defer close(in.events)
+		br := bufio.NewReader(r)
+		var p MIDIParser
+		for {
+			b, err := br.ReadByte()
+			if err != nil {
+				if err != io.EOF {
+					in.err = err
+				}
+				return
+			}
+			if e, ok := p.Feed(b); ok {
+				e.Timestamp = clock()
+				in.events <- e
+			}
+		}
+	}()
+	return in
+}
+
+func (in *readerMIDIInput) Events() <-chan MIDIEvent {
+	return in.events
+}
+
+func (in *readerMIDIInput) Time() time.Duration {
+	return time.Duration(in.clock()) * time.Millisecond
+}
+
+// Close は、読み込み中に発生したエラーを返します。
+// Events のチャンネルが閉じられた後に呼び出す必要があります。
+func (in *readerMIDIInput) Close() error {
+	return in.err
+}
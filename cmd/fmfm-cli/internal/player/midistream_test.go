@@ -0,0 +1,85 @@
+package player
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMIDIParser(t *testing.T) {
+	var p MIDIParser
+	events := []MIDIEvent{}
+	// ランニングステータス、リアルタイムメッセージ、SysEx、プログラムチェンジを含む
+	for _, b := range []byte{0x90, 0x3c, 0x64, 0x3e, 0xf8, 0x64, 0xf0, 0x43, 0x10, 0xf7, 0x40, 0x00, 0xc1, 0x05, 0x06} {
+		if e, ok := p.Feed(b); ok {
+			events = append(events, e)
+		}
+	}
+	assert.Equal(t, []MIDIEvent{
+		{Status: 0x90, Data1: 0x3c, Data2: 0x64},
+		{Status: 0x90, Data1: 0x3e, Data2: 0x64},
+		{Status: 0xc1, Data1: 0x05},
+		{Status: 0xc1, Data1: 0x06},
+	}, events)
+}
+
+func TestParseMIDILine(t *testing.T) {
+	e, ok, err := ParseMIDILine("1500 90 3c 64 # note on")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, MIDIEvent{Timestamp: 1500, Status: 0x90, Data1: 0x3c, Data2: 0x64}, e)
+
+	_, ok, err = ParseMIDILine("  # comment")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = ParseMIDILine("0 90 3c")
+	assert.Error(t, err)
+	_, _, err = ParseMIDILine("0 c0 01 02")
+	assert.Error(t, err)
+}
+
+func TestPipe(t *testing.T) {
+	var buf bytes.Buffer
+	scheduler := &recordScheduler{}
+	pipe := NewPipe(1000, constProcessor{l: .5, r: -1.5}, scheduler, NewPCMWriter(&buf, PCMS16LE))
+	assert.NoError(t, pipe.RenderUntil(3))
+	assert.NoError(t, pipe.RenderUntil(2))
+	assert.NoError(t, pipe.Flush())
+	assert.Equal(t, []int{0, 1, 2}, scheduler.times)
+	assert.Equal(t, 3, pipe.Now())
+	assert.Equal(t, []byte{0x00, 0x40, 0x00, 0x80}, buf.Bytes()[:4])
+	assert.Len(t, buf.Bytes(), 12)
+}
+
+// channelProcessor は、MIDIチャンネル m の信号を m+1 とし、その合計を出力する MIDIChannelProcessor です。
+type channelProcessor struct{}
+
+func (p channelProcessor) Render(outL, outR []float64) {
+	p.RenderMIDIChannels(outL, outR, nil, nil)
+}
+
+func (p channelProcessor) RenderMIDIChannels(outL, outR []float64, busL, busR [][]float64) {
+	for i := range outL {
+		outL[i], outR[i] = 0, 0
+		for m := range busL {
+			busL[m][i], busR[m][i] = float64(m+1)/8.0, -float64(m+1)/8.0
+			outL[i] += busL[m][i]
+			outR[i] += busR[m][i]
+		}
+	}
+}
+
+func TestPipe_SetStems(t *testing.T) {
+	var mix, stem bytes.Buffer
+	pipe := NewPipe(1000, channelProcessor{}, &recordScheduler{}, NewPCMWriter(&mix, PCMF32LE))
+	assert.NoError(t, pipe.SetStems([]*PCMWriter{nil, NewPCMWriter(&stem, PCMS16LE)}))
+	assert.NoError(t, pipe.Render(2))
+	assert.NoError(t, pipe.Flush())
+	assert.Len(t, mix.Bytes(), 16)
+	assert.Equal(t, []byte{0x00, 0x20, 0x00, 0xe0, 0x00, 0x20, 0x00, 0xe0}, stem.Bytes())
+
+	pipe = NewPipe(1000, constProcessor{}, &recordScheduler{}, NewPCMWriter(&mix, PCMF32LE))
+	assert.Error(t, pipe.SetStems([]*PCMWriter{nil}))
+}
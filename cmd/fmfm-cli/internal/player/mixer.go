@@ -0,0 +1,75 @@
+package player
+
+// Mixer は、複数の Processor の出力を加算する Processor です。
+type Mixer struct {
+	processors   []Processor
+	bufL, bufR   []float64
+	sendL, sendR [][]float64
+}
+
+var _ SendProcessor = &Mixer{}
+
+// NewMixer は、processors の出力を加算する新しい Mixer を作成します。
+func NewMixer(processors ...Processor) *Mixer {
+	return &Mixer{processors: processors}
+}
+
+// Render は、各 Processor の出力を加算して outL, outR に書き込みます。
+func (mixer *Mixer) Render(outL, outR []float64) {
+	mixer.RenderWithSends(outL, outR, nil, nil)
+}
+
+// RenderWithSends は、各 Processor の出力とセンドバスの信号をそれぞれ加算して書き込みます。
+// SendProcessor でない Processor は、センドバスに信号を送りません。
+// sendL が nil の場合は、センドバスの信号を書き込みません。
+func (mixer *Mixer) RenderWithSends(outL, outR []float64, sendL, sendR [][]float64) {
+	n := len(outL)
+	clearBuffers(outL, outR)
+	for k := range sendL {
+		clearBuffers(sendL[k], sendR[k])
+	}
+	mixer.bufL, mixer.bufR = resizeBuffer(mixer.bufL, n), resizeBuffer(mixer.bufR, n)
+	bufL, bufR := mixer.bufL, mixer.bufR
+	for len(mixer.sendL) < len(sendL) {
+		mixer.sendL = append(mixer.sendL, nil)
+		mixer.sendR = append(mixer.sendR, nil)
+	}
+	for k := range sendL {
+		mixer.sendL[k], mixer.sendR[k] = resizeBuffer(mixer.sendL[k], n), resizeBuffer(mixer.sendR[k], n)
+	}
+
+	for _, p := range mixer.processors {
+		sp, ok := p.(SendProcessor)
+		if sendL == nil || !ok {
+			p.Render(bufL, bufR)
+			addBuffers(outL, outR, bufL, bufR)
+			continue
+		}
+		sp.RenderWithSends(bufL, bufR, mixer.sendL[:len(sendL)], mixer.sendR[:len(sendL)])
+		addBuffers(outL, outR, bufL, bufR)
+		for k := range sendL {
+			addBuffers(sendL[k], sendR[k], mixer.sendL[k], mixer.sendR[k])
+		}
+	}
+}
+
+func clearBuffers(l, r []float64) {
+	for i := range l {
+		l[i], r[i] = 0, 0
+	}
+}
+
+func addBuffers(dstL, dstR, srcL, srcR []float64) {
+	for i := range dstL {
+		dstL[i] += srcL[i]
+		dstR[i] += srcR[i]
+	}
+}
+
+// resizeBuffer は、buf の長さを n にします。容量が足りない場合は新たに割り当てます。
+func resizeBuffer(buf []float64, n int) []float64 {
+	if cap(buf) < n {
+		return make([]float64, n)
+	}
+	return buf[:n]
+}
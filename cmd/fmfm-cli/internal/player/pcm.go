@@ -0,0 +1,88 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// PCMFormat は、PCM のサンプル形式を表す列挙子型です。
+type PCMFormat int
+
+const (
+	// PCMS16LE は、符号付き16bitリトルエンディアンを表す列挙子です。
+	PCMS16LE PCMFormat = iota + 1
+	// PCMF32LE は、32bit浮動小数点数リトルエンディアンを表す列挙子です。
+	PCMF32LE
+)
+
+func (f PCMFormat) String() string {
+	switch f {
+	case PCMS16LE:
+		return "s16le"
+	case PCMF32LE:
+		return "f32le"
+	default:
+		return "?"
+	}
+}
+
+// ParsePCMFormat は、"s16le" または "f32le" を PCMFormat に変換します。
+func ParsePCMFormat(s string) (PCMFormat, error) {
+	for _, f := range []PCMFormat{PCMS16LE, PCMF32LE} {
+		if s == f.String() {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown PCM format: %s", s)
+}
+
+// PCMWriter は、左右の振幅をインタリーブした PCM として書き出します。
+type PCMWriter struct {
+	w      *bufio.Writer
+	format PCMFormat
+	buf    [8]byte
+}
+
+// NewPCMWriter は、新しい PCMWriter を作成します。
+func NewPCMWriter(w io.Writer, format PCMFormat) *PCMWriter {
+	return &PCMWriter{
+		w:      bufio.NewWriter(w),
+		format: format,
+	}
+}
+
+// Write は、1サンプル分の左右の振幅を書き出します。
+func (pw *PCMWriter) Write(l, r float64) error {
+	var b []byte
+	switch pw.format {
+	case PCMS16LE:
+		binary.LittleEndian.PutUint16(pw.buf[0:], uint16(toInt16(l)))
+		binary.LittleEndian.PutUint16(pw.buf[2:], uint16(toInt16(r)))
+		b = pw.buf[:4]
+	case PCMF32LE:
+		binary.LittleEndian.PutUint32(pw.buf[0:], math.Float32bits(float32(l)))
+		binary.LittleEndian.PutUint32(pw.buf[4:], math.Float32bits(float32(r)))
+		b = pw.buf[:8]
+	}
+	_, err := pw.w.Write(b)
+	return err
+}
+
+// Flush は、バッファに残っているデータを書き出します。
+func (pw *PCMWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+func toInt16(v float64) int16 {
+	v = math.Floor(v*32767.0 + .5)
+	if v < -32768.0 {
+		return -32768
+	}
+	if 32767.0 < v {
+		return 32767
+	}
+	return int16(v)
+}
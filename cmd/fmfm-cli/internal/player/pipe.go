@@ -0,0 +1,166 @@
+package player
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// pipeMaxBlockSize は、Pipe が一度に生成するサンプル数の上限です。
+const pipeMaxBlockSize = 4096
+
+// MIDIChannelProcessor は、MIDIチャンネルごとの信号も併せて生成する Processor です。
+// *sim.Chip はこのインタフェースを満たします。
+type MIDIChannelProcessor interface {
+	Processor
+	// RenderMIDIChannels は、Render と同様に波形を生成し、さらにMIDIチャンネル m の信号を busL[m], busR[m] に書き込みます。
+	RenderMIDIChannels(outL, outR []float64, busL, busR [][]float64)
+}
+
+// Pipe は、オーディオデバイスを使用せず、サンプルクロックに従って波形をレンダリングし、PCM として書き出します。
+type Pipe struct {
+	// samples は、生成したサンプル数です。atomic で操作するため、先頭に配置します。
+	samples    int64
+	processor  Processor
+	scheduler  Scheduler
+	insertions []Insertion
+	output     *PCMWriter
+	sampleRate float64
+	bufL, bufR []float64
+	// stems は、各MIDIチャンネルの信号の書き出し先です。書き出さないMIDIチャンネルは nil です。
+	stems        []*PCMWriter
+	busL, busR   [][]float64
+	viewL, viewR [][]float64
+}
+
+// NewPipe は、processor によって生成される波形を output に書き出す新しい Pipe を作成します。
+// MIDIメッセージは、サンプルクロック上の時刻に従って scheduler により処理されます。
+func NewPipe(sampleRate float64, processor Processor, scheduler Scheduler, output *PCMWriter) *Pipe {
+	return &Pipe{
+		processor:  processor,
+		scheduler:  scheduler,
+		insertions: []Insertion{},
+		output:     output,
+		sampleRate: sampleRate,
+		bufL:       make([]float64, pipeMaxBlockSize),
+		bufR:       make([]float64, pipeMaxBlockSize),
+	}
+}
+
+// Insert は、インサーションエフェクトを追加します。
+func (p *Pipe) Insert(insertion Insertion) {
+	p.insertions = append(p.insertions, insertion)
+}
+
+// SetStems は、MIDIチャンネル m の信号を stems[m] にも書き出すよう設定します。
+// 書き出さないMIDIチャンネルには nil を指定します。
+// 各MIDIチャンネルの信号にはインサーションエフェクトを適用しません。
+// processor が MIDIChannelProcessor でない場合はエラーを返します。
+func (p *Pipe) SetStems(stems []*PCMWriter) error {
+	if _, ok := p.processor.(MIDIChannelProcessor); !ok {
+		return errors.New("processor does not support per-MIDI-channel output")
+	}
+	p.stems = stems
+	p.busL = make([][]float64, len(stems))
+	p.busR = make([][]float64, len(stems))
+	p.viewL = make([][]float64, len(stems))
+	p.viewR = make([][]float64, len(stems))
+	for m := range stems {
+		p.busL[m] = make([]float64, pipeMaxBlockSize)
+		p.busR[m] = make([]float64, pipeMaxBlockSize)
+	}
+	return nil
+}
+
+// Now は、サンプルクロック上の現在時刻[ms]を返します。
+// 他のゴルーチンから呼び出すことができます。
+func (p *Pipe) Now() int {
+	return p.msAt(atomic.LoadInt64(&p.samples))
+}
+
+func (p *Pipe) msAt(samples int64) int {
+	return int(float64(samples) * 1000.0 / p.sampleRate)
+}
+
+// Render は、n サンプル分の波形を書き出します。
+func (p *Pipe) Render(n int) error {
+	for 0 < n {
+		size := n
+		if pipeMaxBlockSize < size {
+			size = pipeMaxBlockSize
+		}
+		if err := p.renderBlock(size); err != nil {
+			return err
+		}
+		n -= size
+	}
+	return nil
+}
+
+func (p *Pipe) renderBlock(n int) error {
+	base := atomic.LoadInt64(&p.samples)
+	p.scheduler.ScheduleBlock(n, func(i int) int {
+		return p.msAt(base + int64(i))
+	}, func(from, to int) {
+		p.renderRange(from, to)
+		atomic.StoreInt64(&p.samples, base+int64(to))
+	})
+	for i := 0; i < n; i++ {
+		l, r := p.bufL[i], p.bufR[i]
+		for _, insertion := range p.insertions {
+			l, r = insertion.Next(l, r)
+		}
+		if err := p.output.Write(l, r); err != nil {
+			return err
+		}
+		for m, stem := range p.stems {
+			if stem == nil {
+				continue
+			}
+			if err := stem.Write(p.busL[m][i], p.busR[m][i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Pipe) renderRange(from, to int) {
+	if p.stems == nil {
+		p.processor.Render(p.bufL[from:to], p.bufR[from:to])
+		return
+	}
+	for m := range p.stems {
+		p.viewL[m], p.viewR[m] = p.busL[m][from:to], p.busR[m][from:to]
+	}
+	p.processor.(MIDIChannelProcessor).RenderMIDIChannels(p.bufL[from:to], p.bufR[from:to], p.viewL, p.viewR)
+}
+
+// RenderUntil は、サンプルクロック上の時刻が ms[ms] に達するまで波形を書き出します。
+func (p *Pipe) RenderUntil(ms int) error {
+	samples := atomic.LoadInt64(&p.samples)
+	end := int64(math.Ceil(float64(ms) * p.sampleRate / 1000.0))
+	for 0 < end && ms <= p.msAt(end-1) {
+		end--
+	}
+	for p.msAt(end) < ms {
+		end++
+	}
+	if end <= samples {
+		return nil
+	}
+	return p.Render(int(end - samples))
+}
+
+// Flush は、書き出した波形をすべて出力します。
+func (p *Pipe) Flush() error {
+	for _, stem := range p.stems {
+		if stem == nil {
+			continue
+		}
+		if err := stem.Flush(); err != nil {
+			return err
+		}
+	}
+	return p.output.Flush()
+}
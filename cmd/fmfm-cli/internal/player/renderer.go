@@ -1,97 +1,171 @@
 package player
 
 import (
-	"fmt"
 	"math"
-	"sync"
 	"time"
 
-	"github.com/gordonklaus/portaudio"
-	"github.com/xlab/closer"
+	"github.com/but80/fmfm.core/ymf"
 )
 
+// AudioOutput は、波形を出力するオーディオデバイスを抽象化したインタフェースです。
+type AudioOutput interface {
+	// SampleRate は、出力のサンプルレートを返します。
+	SampleRate() float64
+	// Latency は、出力の遅延を返します。Start の前は 0 を返します。
+	Latency() time.Duration
+	// Time は、出力のクロック上の現在時刻を返します。Start の前は 0 を返します。
+	Time() time.Duration
+	// Start は、出力を開始します。
+	// callback は、左右それぞれのチャンネルのバッファを満たすために繰り返し呼び出されます。
+	// outputTime は、バッファの先頭のサンプルが出力される、出力のクロック上の時刻です。
+	Start(callback func(out [][]float32, outputTime time.Duration)) error
+	// Close は、出力を終了し、デバイスを解放します。
+	Close() error
+}
+
+// AudioOutputOpts は、出力先のオーディオデバイスの選択と出力の設定です。
+type AudioOutputOpts struct {
+	// HostAPI は、使用するホストAPIの名前です。空の場合は既定のホストAPIを使用します。
+	HostAPI string
+	// Device は、出力先のデバイスの名前です。空の場合はホストAPIの既定の出力デバイスを使用します。
+	Device string
+	// FramesPerBuffer は、1回のコールバックで出力するフレーム数です。0 の場合はデバイスに任せます。
+	FramesPerBuffer int
+	// LowLatency は、デバイスの既定の低遅延の設定を使用するかどうかです。
+	// false の場合は既定の高遅延の設定を使用します。
+	LowLatency bool
+	// Latency は、出力の遅延の目安です。0 より大きい場合は LowLatency より優先されます。
+	Latency time.Duration
+}
+
+// Processor は、波形をブロック単位で生成する音源を抽象化したインタフェースです。
+// *sim.Chip はこのインタフェースを満たします。
+type Processor interface {
+	// Render は、len(outL) サンプル分の波形を生成し、左右それぞれの振幅を outL, outR に書き込みます。
+	Render(outL, outR []float64)
+}
+
+// Scheduler は、ブロックをMIDIメッセージの時刻で分割して処理するコントローラを抽象化したインタフェースです。
+// *fmfm.Controller はこのインタフェースを満たします。
+type Scheduler interface {
+	// ScheduleBlock は、n サンプルのブロックを、MIDIメッセージの時刻で分割して処理します。
+	// 詳細は fmfm.Controller の ScheduleBlock を参照してください。
+	ScheduleBlock(n int, timeAt func(i int) int, render func(from, to int))
+}
+
 // Renderer は、波形をレンダリングしてオーディオデバイスに出力します。
 // TODO: rename
 type Renderer struct {
-	Parameters portaudio.StreamParameters
-	stream     *portaudio.Stream
-	insertions []Insertion
+	output            AudioOutput
+	insertions        []Insertion
+	logger            ymf.Logger
+	midiClock         func() time.Duration
+	schedulingLatency time.Duration
 }
 
-var portautioInitOnce = sync.Once{}
+// DefaultSchedulingLatency は、Renderer の既定のスケジューリング遅延です。
+const DefaultSchedulingLatency = 30 * time.Millisecond
 
-// NewRenderer は、新しいRendererを作成します。
-func NewRenderer() *Renderer {
-	renderer := &Renderer{
-		insertions: []Insertion{},
-	}
-	portautioInitOnce.Do(func() {
-		portaudio.Initialize()
-		closer.Bind(func() {
-			portaudio.Terminate()
-		})
-	})
+// clockOffsetSmoothing は、MIDIのクロックと出力のクロックの差の推定値を更新する際の平滑化の係数の逆数です。
+const clockOffsetSmoothing = 16
 
-	h, err := portaudio.DefaultHostApi()
+// NewRenderer は、opts に従って選択したオーディオデバイスに出力する新しいRendererを作成します。
+// opts が nil の場合は既定のオーディオデバイスを使用します。
+// logger が nil の場合は ymf.DefaultLogger を使用します。
+// 使用後は Close を呼び出す必要があります。
+func NewRenderer(opts *AudioOutputOpts, logger ymf.Logger) (*Renderer, error) {
+	if opts == nil {
+		opts = &AudioOutputOpts{}
+	}
+	if logger == nil {
+		logger = ymf.DefaultLogger
+	}
+	output, err := openAudioOutput(opts, logger)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	return NewRendererWithOutput(output, logger), nil
+}
+
+// NewRendererWithOutput は、output に出力する新しいRendererを作成します。
+// logger が nil の場合は ymf.DefaultLogger を使用します。
+func NewRendererWithOutput(output AudioOutput, logger ymf.Logger) *Renderer {
+	if logger == nil {
+		logger = ymf.DefaultLogger
+	}
+	start := time.Now()
+	return &Renderer{
+		output:     output,
+		insertions: []Insertion{},
+		logger:     logger,
+		midiClock: func() time.Duration {
+			return time.Since(start)
+		},
+		schedulingLatency: DefaultSchedulingLatency,
 	}
-	selectedDevinfo := h.DefaultOutputDevice
-	fmt.Printf("Audio device: %s\n", selectedDevinfo.Name)
-
-	// var selectedDevinfo *portaudio.DeviceInfo
-	// devinfos, err := portaudio.Devices()
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// for _, devinfo := range devinfos {
-	// 	if 0 < devinfo.MaxOutputChannels {
-	// 		if deviceName == devinfo.Name {
-	// 			selectedDevinfo = devinfo
-	// 		}
-	// 	}
-	// }
-	// if selectedDevinfo == nil {
-	// 	panic("device not found")
-	// }
-
-	renderer.Parameters = portaudio.HighLatencyParameters(nil, selectedDevinfo)
-	// params := portaudio.StreamParameters{
-	// 	Output: portaudio.StreamDeviceParameters{
-	// 		Device: selectedDevinfo,
-	// 		channels: selectedDevinfo.MaxOutputChannels,
-	// 		Latency: selectedDevinfo.DefaultHighOutputLatency,
-	// 	},
-	// 	SampleRate: sampleRate,
-	// 	FramesPerBuffer: 0,
-	// }
+}
 
+// SetMIDIClock は、MIDIメッセージの時刻の基準となるクロックを設定します。
+// 既定では Renderer を作成した時点からの経過時間を使用します。
+func (renderer *Renderer) SetMIDIClock(clock func() time.Duration) *Renderer {
+	renderer.midiClock = clock
 	return renderer
 }
 
+// SetSchedulingLatency は、MIDIメッセージを受信してから発音するまでの、出力の遅延に加える固定の遅延を設定します。
+// 1回のコールバックで出力するバッファの長さより短い場合、MIDIメッセージの処理が遅れることがあります。
+func (renderer *Renderer) SetSchedulingLatency(latency time.Duration) *Renderer {
+	renderer.schedulingLatency = latency
+	return renderer
+}
+
+// SampleRate は、出力のサンプルレートを返します。
+func (renderer *Renderer) SampleRate() float64 {
+	return renderer.output.SampleRate()
+}
+
 // Insert は、インサーションエフェクトを追加します。
 func (renderer *Renderer) Insert(insertion Insertion) {
 	renderer.insertions = append(renderer.insertions, insertion)
 }
 
 // Start は、processor によって生成される波形のオーディオデバイスへの出力を開始します。
-func (renderer *Renderer) Start(processor func() (float64, float64), controller func(int)) {
-	startTime := time.Now()
+// 各バッファは scheduler によってMIDIメッセージの時刻で分割され、区間ごとにまとめて生成されます。
+// 時刻 t に受信したMIDIメッセージは、出力の遅延とスケジューリング遅延を加えた時刻に出力されるサンプルで処理されます。
+func (renderer *Renderer) Start(processor Processor, scheduler Scheduler) error {
 	maxLevel := 32766.0 / 32767.0
+	sampleLen := float64(time.Second) / renderer.output.SampleRate()
+	var clockOffset time.Duration
+	clockSynced := false
+	var bufL, bufR []float64
+
+	renderer.logger.Printf("insertion %#v", renderer.insertions)
+
+	err := renderer.output.Start(func(out [][]float32, outputTime time.Duration) {
+		// MIDIのクロックと出力のクロックの差を推定する
+		measured := renderer.midiClock() - renderer.output.Time()
+		if clockSynced {
+			clockOffset += (measured - clockOffset) / clockOffsetSmoothing
+		} else {
+			clockOffset = measured
+			clockSynced = true
+		}
+		delay := renderer.output.Latency() + renderer.schedulingLatency
+		first := float64(outputTime + clockOffset - delay)
 
-	fmt.Printf("insertion %#v\n", renderer.insertions)
-
-	var err error
-	renderer.stream, err = portaudio.OpenStream(renderer.Parameters, func(out [][]float32) {
-		// midiLatency := float64(renderer.stream.Info().OutputLatency) / float64(time.Millisecond)
-		sampleLen := 1000.0 / renderer.Parameters.SampleRate
-		midiLatency := float64(len(out[0])) * sampleLen
-		now := float64(time.Since(startTime)) / float64(time.Millisecond)
-		for i := range out[0] {
-			now += sampleLen
-			controller(int(now - midiLatency))
+		n := len(out[0])
+		if len(bufL) < n {
+			bufL = make([]float64, n)
+			bufR = make([]float64, n)
+		}
+		scheduler.ScheduleBlock(n, func(i int) int {
+			return int((first + float64(i)*sampleLen) / float64(time.Millisecond))
+		}, func(from, to int) {
+			processor.Render(bufL[from:to], bufR[from:to])
+		})
 
-			l, r := processor()
+		for i := 0; i < n; i++ {
+			l, r := bufL[i], bufR[i]
 			for _, insertion := range renderer.insertions {
 				l, r = insertion.Next(l, r)
 			}
@@ -104,7 +178,7 @@ func (renderer *Renderer) Start(processor func() (float64, float64), controller
 					maxLevel = r
 				}
 				db := math.Log10(maxLevel) * 20.0
-				fmt.Printf("Clipping occurred: %2.1f\n", db)
+				renderer.logger.Printf("Clipping occurred: %2.1f", db)
 			}
 
 			out[0][i] = float32(l)
@@ -112,14 +186,16 @@ func (renderer *Renderer) Start(processor func() (float64, float64), controller
 		}
 	})
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Printf("Sample rate: %f\n", renderer.stream.Info().SampleRate)
-	fmt.Printf("Output latency: %s\n", renderer.stream.Info().OutputLatency.String())
+	renderer.logger.Printf("Sample rate: %f", renderer.output.SampleRate())
+	renderer.logger.Printf("Output latency: %s", renderer.output.Latency().String())
+	renderer.logger.Printf("Scheduling latency: %s", renderer.schedulingLatency.String())
+	return nil
+}
 
-	err = renderer.stream.Start()
-	if err != nil {
-		panic(err)
-	}
+// Close は、オーディオデバイスへの出力を終了します。
+func (renderer *Renderer) Close() error {
+	return renderer.output.Close()
 }
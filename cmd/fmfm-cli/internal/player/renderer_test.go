@@ -0,0 +1,70 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOutput struct {
+	now      time.Duration
+	callback func(out [][]float32, outputTime time.Duration)
+}
+
+func (o *fakeOutput) SampleRate() float64    { return 1000 }
+func (o *fakeOutput) Latency() time.Duration { return 10 * time.Millisecond }
+func (o *fakeOutput) Time() time.Duration    { return o.now }
+func (o *fakeOutput) Close() error           { return nil }
+
+func (o *fakeOutput) Start(callback func(out [][]float32, outputTime time.Duration)) error {
+	o.callback = callback
+	return nil
+}
+
+type constProcessor struct {
+	l, r float64
+}
+
+func (p constProcessor) Render(outL, outR []float64) {
+	for i := range outL {
+		outL[i], outR[i] = p.l, p.r
+	}
+}
+
+// recordScheduler は、各サンプルの時刻を記録し、ブロックを分割せずに生成する Scheduler です。
+type recordScheduler struct {
+	times []int
+}
+
+func (s *recordScheduler) ScheduleBlock(n int, timeAt func(i int) int, render func(from, to int)) {
+	for i := 0; i < n; i++ {
+		s.times = append(s.times, timeAt(i))
+	}
+	render(0, n)
+}
+
+func TestRenderer_timing(t *testing.T) {
+	for _, bufferSize := range []int{4, 16} {
+		output := &fakeOutput{}
+		renderer := NewRendererWithOutput(output, ymf.NopLogger)
+		renderer.SetMIDIClock(func() time.Duration {
+			// MIDIのクロックは出力のクロックより5秒進んでいる
+			return output.now + 5*time.Second
+		}).SetSchedulingLatency(20 * time.Millisecond)
+		scheduler := &recordScheduler{}
+		assert.NoError(t, renderer.Start(constProcessor{}, scheduler))
+
+		// 出力時刻が 100ms から途切れなく続くバッファ
+		for pos := 0; pos < 32; pos += bufferSize {
+			output.now = time.Duration(pos+90) * time.Millisecond
+			out := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+			output.callback(out, time.Duration(pos+100)*time.Millisecond)
+		}
+		for i, ms := range scheduler.times {
+			assert.Equal(t, 5070+i, ms)
+		}
+		assert.Len(t, scheduler.times, 32)
+	}
+}
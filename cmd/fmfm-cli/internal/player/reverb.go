@@ -0,0 +1,112 @@
+package player
+
+import (
+	"math"
+)
+
+// reverbCombTunings, reverbAllpassTunings は、44.1kHz におけるコムフィルタとオールパスフィルタの遅延 [サンプル] です。
+var (
+	reverbCombTunings    = []int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllpassTunings = []int{556, 441, 341, 225}
+)
+
+// reverbStereoSpread は、右チャンネルの遅延に加える 44.1kHz におけるサンプル数です。
+const reverbStereoSpread = 23
+
+// reverbInputGain は、コムフィルタに入力する前にかける倍率です。
+const reverbInputGain = .015
+
+type reverbComb struct {
+	buffer      []float64
+	pos         int
+	filterStore float64
+}
+
+func (c *reverbComb) next(in, feedback, damp float64) float64 {
+	out := c.buffer[c.pos]
+	c.filterStore = out*(1.0-damp) + c.filterStore*damp
+	c.buffer[c.pos] = in + c.filterStore*feedback
+	c.pos = (c.pos + 1) % len(c.buffer)
+	return out
+}
+
+type reverbAllpass struct {
+	buffer []float64
+	pos    int
+}
+
+func (a *reverbAllpass) next(in float64) float64 {
+	buffered := a.buffer[a.pos]
+	a.buffer[a.pos] = in + buffered*.5
+	a.pos = (a.pos + 1) % len(a.buffer)
+	return buffered - in
+}
+
+// Reverb は、センドエフェクト「リバーブ」です。
+// 並列のコムフィルタと直列のオールパスフィルタによる Schroeder-Moorer 型の残響を生成します。
+// センドエフェクトとして使用するため、Next は原音を含まない残響音のみを返します。
+type Reverb struct {
+	sampleRate float64
+	feedback   float64
+	damp       float64
+	level      float64
+	combs      [2][]*reverbComb
+	allpasses  [2][]*reverbAllpass
+}
+
+var _ Insertion = &Reverb{}
+
+// NewReverb は、新しい Reverb を作成します。
+func NewReverb(sampleRate float64) *Reverb {
+	rev := &Reverb{
+		sampleRate: sampleRate,
+	}
+	scale := sampleRate / 44100.0
+	for ch := 0; ch < 2; ch++ {
+		spread := ch * reverbStereoSpread
+		for _, n := range reverbCombTunings {
+			rev.combs[ch] = append(rev.combs[ch], &reverbComb{
+				buffer: make([]float64, int(float64(n+spread)*scale)+1),
+			})
+		}
+		for _, n := range reverbAllpassTunings {
+			rev.allpasses[ch] = append(rev.allpasses[ch], &reverbAllpass{
+				buffer: make([]float64, int(float64(n+spread)*scale)+1),
+			})
+		}
+	}
+	return rev.SetRoomSize(.5).SetDamping(.5).SetLevel(.0)
+}
+
+// SetRoomSize は、残響の長さを 0〜1 の範囲で設定します。
+func (rev *Reverb) SetRoomSize(v float64) *Reverb {
+	rev.feedback = .7 + .28*math.Max(.0, math.Min(1.0, v))
+	return rev
+}
+
+// SetDamping は、残響の高域の減衰を 0〜1 の範囲で設定します。
+func (rev *Reverb) SetDamping(v float64) *Reverb {
+	rev.damp = .4 * math.Max(.0, math.Min(1.0, v))
+	return rev
+}
+
+// SetLevel は、残響音の出力レベル [dB] を設定します。
+func (rev *Reverb) SetLevel(v float64) *Reverb {
+	rev.level = math.Pow(10, v/20.0)
+	return rev
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (rev *Reverb) Next(l, r float64) (float64, float64) {
+	in := (l + r) * reverbInputGain
+	var out [2]float64
+	for ch := range out {
+		for _, c := range rev.combs[ch] {
+			out[ch] += c.next(in, rev.feedback, rev.damp)
+		}
+		for _, a := range rev.allpasses[ch] {
+			out[ch] = a.next(out[ch])
+		}
+	}
+	return out[0] * rev.level, out[1] * rev.level
+}
@@ -0,0 +1,60 @@
+package player
+
+import (
+	"github.com/but80/fmfm.core/sim"
+)
+
+// SendProcessor は、センドエフェクトへ送る信号も併せて生成する Processor です。
+// *sim.Chip はこのインタフェースを満たします。
+type SendProcessor interface {
+	Processor
+	// RenderWithSends は、Render と同様に波形を生成し、さらに各センドバスの信号を sendL[k], sendR[k] に書き込みます。
+	// sendL, sendR は、sim.Send の値をインデックスとする sim.SendCount 個のバッファです。
+	RenderWithSends(outL, outR []float64, sendL, sendR [][]float64)
+}
+
+// SendEffects は、SendProcessor の出力に、各センドバスの信号を処理したセンドエフェクトの出力を加える Processor です。
+type SendEffects struct {
+	processor    SendProcessor
+	effects      [sim.SendCount]Insertion
+	sendL, sendR [][]float64
+}
+
+var _ Processor = &SendEffects{}
+
+// NewSendEffects は、processor の出力にセンドエフェクトを加える新しい SendEffects を作成します。
+// センドエフェクトは SetEffect で設定します。
+func NewSendEffects(processor SendProcessor) *SendEffects {
+	return &SendEffects{
+		processor: processor,
+		sendL:     make([][]float64, sim.SendCount),
+		sendR:     make([][]float64, sim.SendCount),
+	}
+}
+
+// SetEffect は、センドバス send の信号を処理するセンドエフェクトを設定します。
+// nil を指定した場合、そのセンドバスの信号は破棄されます。
+func (e *SendEffects) SetEffect(send sim.Send, effect Insertion) *SendEffects {
+	e.effects[send] = effect
+	return e
+}
+
+// Render は、len(outL) サンプル分の波形を生成し、左右それぞれの振幅を outL, outR に書き込みます。
+func (e *SendEffects) Render(outL, outR []float64) {
+	n := len(outL)
+	for k := range e.sendL {
+		e.sendL[k], e.sendR[k] = resizeBuffer(e.sendL[k], n), resizeBuffer(e.sendR[k], n)
+	}
+	e.processor.RenderWithSends(outL, outR, e.sendL, e.sendR)
+	for k, effect := range e.effects {
+		if effect == nil {
+			continue
+		}
+		sendL, sendR := e.sendL[k], e.sendR[k]
+		for i := range outL {
+			l, r := effect.Next(sendL[i], sendR[i])
+			outL[i] += l
+			outR[i] += r
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package player
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/fmfm.core/sim"
+	"github.com/stretchr/testify/assert"
+)
+
+// impulseSendProcessor は、最初のサンプルでのみリバーブのセンドバスにインパルスを送る SendProcessor です。
+type impulseSendProcessor struct {
+	constProcessor
+	sent bool
+}
+
+func (p *impulseSendProcessor) RenderWithSends(outL, outR []float64, sendL, sendR [][]float64) {
+	p.Render(outL, outR)
+	for k := range sendL {
+		for i := range sendL[k] {
+			sendL[k][i], sendR[k][i] = 0, 0
+		}
+	}
+	if !p.sent {
+		sendL[sim.SendReverb][0], sendR[sim.SendReverb][0] = 1, 1
+		p.sent = true
+	}
+}
+
+func TestSendEffects(t *testing.T) {
+	processor := &impulseSendProcessor{constProcessor: constProcessor{l: .5, r: -.5}}
+	effects := NewSendEffects(processor).
+		SetEffect(sim.SendReverb, NewReverb(44100)).
+		SetEffect(sim.SendChorus, NewChorus(44100))
+	l := make([]float64, 44100)
+	r := make([]float64, 44100)
+	effects.Render(l, r)
+
+	assert.Equal(t, .5, l[0])
+	assert.Equal(t, -.5, r[0])
+	tail := func(from, to int) float64 {
+		result := .0
+		for i := from; i < to; i++ {
+			result = math.Max(result, math.Abs(l[i]-.5))
+		}
+		return result
+	}
+	assert.True(t, .001 < tail(0, 4410), "reverb tail should follow the impulse")
+	assert.True(t, tail(39690, 44100) < tail(0, 4410), "reverb tail should decay")
+
+	// センドバスがないと、センドエフェクトの出力は加わらない
+	processor = &impulseSendProcessor{constProcessor: constProcessor{l: .5, r: -.5}, sent: true}
+	NewSendEffects(processor).SetEffect(sim.SendReverb, NewReverb(44100)).Render(l, r)
+	assert.Equal(t, .0, tail(0, 44100))
+}
+
+func TestMixer_RenderWithSends(t *testing.T) {
+	mixer := NewMixer(&impulseSendProcessor{}, constProcessor{l: .25, r: .25}, &impulseSendProcessor{})
+	l := make([]float64, 4)
+	r := make([]float64, 4)
+	sendL := [][]float64{make([]float64, 4), make([]float64, 4)}
+	sendR := [][]float64{make([]float64, 4), make([]float64, 4)}
+	mixer.RenderWithSends(l, r, sendL, sendR)
+	assert.Equal(t, []float64{.25, .25, .25, .25}, l)
+	assert.Equal(t, []float64{2, 0, 0, 0}, sendL[sim.SendReverb])
+	assert.Equal(t, []float64{0, 0, 0, 0}, sendL[sim.SendChorus])
+}
@@ -1,116 +1,185 @@
 package player
 
 import (
+	"errors"
 	"fmt"
-	"sync"
+	"regexp"
+	"strconv"
+	"time"
 
 	fmfm "github.com/but80/fmfm.core"
-	"github.com/xlab/portmidi"
+	"github.com/but80/fmfm.core/ymf"
 )
 
-const defaultMIDIDeviceName = "IAC YAMAHA Virtual MIDI Device 0"
+// ErrNoMIDIDevice は、MIDIデバイスが1つも見つからないことを表すエラーです。
+var ErrNoMIDIDevice = errors.New("no MIDI device")
 
-// Sequencer は、PortMIDI により MIDIメッセージを受信して Chip のレジスタをコントロールします。
-// TODO: rename
-type Sequencer struct {
-	*fmfm.Controller
-	input *portmidi.Stream
+// MIDIEvent は、MIDIデバイスから受信したメッセージです。
+type MIDIEvent struct {
+	// Timestamp は、受信時刻[ms]です。
+	Timestamp int
+	// Status, Data1, Data2 は、MIDIメッセージのステータスバイトとデータバイトです。
+	Status, Data1, Data2 int
+}
+
+// MIDIInput は、MIDIメッセージを受信するデバイスを抽象化したインタフェースです。
+type MIDIInput interface {
+	// Events は、受信したメッセージを順に送るチャンネルを返します。
+	Events() <-chan MIDIEvent
+	// Time は、メッセージの Timestamp と同じクロック上の現在時刻を返します。
+	Time() time.Duration
+	// Close は、受信を終了し、デバイスを解放します。
+	Close() error
+}
+
+// MIDIChannelRange は、MIDI入力から受信したメッセージを割り当てる、Controller のMIDIチャンネルの範囲です。
+// MIDIチャンネル番号は 0 から数えます。
+type MIDIChannelRange struct {
+	// First, Last は、範囲の最初と最後のMIDIチャンネル番号です。
+	First, Last int
+}
+
+// DefaultMIDIChannelRange は、受信したメッセージのMIDIチャンネルをそのまま使用する範囲です。
+var DefaultMIDIChannelRange = MIDIChannelRange{First: 0, Last: 15}
+
+// Map は、受信したメッセージのMIDIチャンネル番号 ch (0〜15) を、範囲内のMIDIチャンネル番号に変換します。
+// 変換後のMIDIチャンネル番号が範囲外となる場合は false を返します。
+func (r MIDIChannelRange) Map(ch int) (int, bool) {
+	result := r.First + ch
+	return result, result <= r.Last
 }
 
-var newSequencerOnce = sync.Once{}
+// MIDIPort は、MIDI入力デバイスと、そこから受信したメッセージを割り当てるMIDIチャンネルの範囲です。
+type MIDIPort struct {
+	// Device は、MIDIデバイスの名前です。空の場合は既定のデバイスを使用します。
+	Device string
+	// Channels は、受信したメッセージを割り当てるMIDIチャンネルの範囲です。
+	Channels MIDIChannelRange
+}
 
-// NewSequencer は、新しい Sequencer を作成します。
-func NewSequencer(midiDevice string, opts *fmfm.ControllerOpts) *Sequencer {
-	if midiDevice == "@" {
-		midiDevice = defaultMIDIDeviceName
+var midiPortRangePattern = regexp.MustCompile(`:(\d+)-(\d+)$`)
+
+// ParseMIDIPort は、"<デバイス名>[:<最初のチャンネル>-<最後のチャンネル>]" 形式の文字列を解析します。
+// チャンネル番号は 1 から数えます。例えば "Port B:17-32" は、
+// "Port B" から受信したMIDIチャンネル1〜16のメッセージをMIDIチャンネル17〜32として扱います。
+// 範囲を省略した場合は DefaultMIDIChannelRange を使用します。
+func ParseMIDIPort(spec string) (MIDIPort, error) {
+	port := MIDIPort{Device: spec, Channels: DefaultMIDIChannelRange}
+	m := midiPortRangePattern.FindStringSubmatch(spec)
+	if m == nil {
+		return port, nil
+	}
+	first, _ := strconv.Atoi(m[1])
+	last, _ := strconv.Atoi(m[2])
+	if first < 1 || last < first {
+		return MIDIPort{}, fmt.Errorf("invalid MIDI channel range: %s", spec)
 	}
+	port.Device = spec[:len(spec)-len(m[0])]
+	port.Channels = MIDIChannelRange{First: first - 1, Last: last - 1}
+	return port, nil
+}
 
-	newSequencerOnce.Do(func() {
-		portmidi.Initialize()
-		if portmidi.CountDevices() < 1 {
-			panic("no midi device")
-		}
-	})
+// MappedMIDIInput は、MIDI入力と、そこから受信したメッセージを割り当てるMIDIチャンネルの範囲です。
+type MappedMIDIInput struct {
+	Input    MIDIInput
+	Channels MIDIChannelRange
+}
 
-	var selectedMIDIDeviceID portmidi.DeviceID
+// Sequencer は、MIDIメッセージを受信して Chip のレジスタをコントロールします。
+// 複数のMIDI入力から受信したメッセージは、時刻順に統合されて処理されます。
+// TODO: rename
+type Sequencer struct {
+	*fmfm.Controller
+	inputs []MappedMIDIInput
+}
 
-	if midiDevice == "" {
-		var found bool
-		selectedMIDIDeviceID, found = portmidi.DefaultInputDeviceID()
-		if !found {
-			panic("No default MIDI device found")
-		}
-	} else {
-		var found bool
-		for i := 0; i < portmidi.CountDevices(); i++ {
-			deviceID := portmidi.DeviceID(i)
-			info := portmidi.GetDeviceInfo(deviceID)
-			if info.IsInputAvailable && info.Name == midiDevice {
-				selectedMIDIDeviceID = deviceID
-				found = true
-				break
+// NewSequencer は、ports に指定されたMIDIデバイスから受信する新しい Sequencer を作成します。
+// 全MIDIデバイスのメッセージの時刻は、同じクロックに基づいている必要があります。
+// 進捗は opts.Logger に出力されます。
+func NewSequencer(ports []MIDIPort, opts *fmfm.ControllerOpts) (*Sequencer, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = ymf.DefaultLogger
+	}
+	inputs := []MappedMIDIInput{}
+	for _, port := range ports {
+		input, err := openMIDIInput(port.Device, logger)
+		if err != nil {
+			for _, in := range inputs {
+				in.Input.Close()
 			}
+			return nil, err
 		}
-		if !found {
-			panic("No such MIDI device found: " + midiDevice)
-		}
+		inputs = append(inputs, MappedMIDIInput{Input: input, Channels: port.Channels})
 	}
+	return NewSequencerWithInputs(inputs, opts), nil
+}
 
-	info := portmidi.GetDeviceInfo(selectedMIDIDeviceID)
-	fmt.Printf("MIDI device: %s > %s\n", info.Interface, info.Name)
-
-	input, err := portmidi.NewInputStream(selectedMIDIDeviceID, 512, 0)
-	if err != nil {
-		panic(err)
-	}
+// NewSequencerWithInput は、input から受信する新しい Sequencer を作成します。
+func NewSequencerWithInput(input MIDIInput, opts *fmfm.ControllerOpts) *Sequencer {
+	return NewSequencerWithInputs([]MappedMIDIInput{{Input: input, Channels: DefaultMIDIChannelRange}}, opts)
+}
 
+// NewSequencerWithInputs は、複数のMIDI入力から受信する新しい Sequencer を作成します。
+// inputs は1つ以上である必要があります。
+func NewSequencerWithInputs(inputs []MappedMIDIInput, opts *fmfm.ControllerOpts) *Sequencer {
 	seq := &Sequencer{
 		Controller: fmfm.NewController(opts),
-		input:      input,
+		inputs:     inputs,
 	}
 
-	go func() {
-		for e := range seq.input.Source() {
-			if e.Timestamp < 0 {
-				continue
-			}
-			msg := portmidi.Message(e.Message)
-			status := int(msg.Status())
-			channel := int(status & 15)
-			var typ fmfm.MIDIMessage
-			switch status & 0xf0 {
-			case 0x90:
-				typ = fmfm.MIDINoteOn
-			case 0x80:
-				typ = fmfm.MIDINoteOff
-			case 0xb0:
-				typ = fmfm.MIDIControlChange
-			case 0xc0:
-				typ = fmfm.MIDIProgramChange
-			case 0xe0:
-				typ = fmfm.MIDIPitchBend
+	for _, in := range inputs {
+		go func(in MappedMIDIInput) {
+			for e := range in.Input.Events() {
+				if ch, ok := in.Channels.Map(e.Status & 15); ok {
+					pushMIDIEvent(seq.Controller, e, ch)
+				}
 			}
-			seq.PushMIDIMessage(typ, int(e.Timestamp), channel, int(msg.Data1()), int(msg.Data2()))
-		}
-	}()
+		}(in)
+	}
 
 	return seq
 }
 
-// Close は、MIDIメッセージの受信を終了します。
-func (seq *Sequencer) Close() {
-	seq.input.Close()
+// Time は、受信するMIDIメッセージの時刻と同じクロック上の現在時刻を返します。
+// Renderer.SetMIDIClock に渡すことで、MIDIメッセージの時刻を出力の時刻に対応付けることができます。
+func (seq *Sequencer) Time() time.Duration {
+	return seq.inputs[0].Input.Time()
 }
 
-// ListMIDIDeivces は、入力として選択可能なMIDIデバイスの一覧を取得します。
-func ListMIDIDeivces() []string {
-	result := []string{}
-	for i := 0; i < portmidi.CountDevices(); i++ {
-		deviceID := portmidi.DeviceID(i)
-		info := portmidi.GetDeviceInfo(deviceID)
-		if info.IsInputAvailable && info.Name != "" {
-			result = append(result, info.Name)
+// Close は、MIDIメッセージの受信を終了します。
+func (seq *Sequencer) Close() error {
+	var result error
+	for _, in := range seq.inputs {
+		if err := in.Input.Close(); err != nil && result == nil {
+			result = err
 		}
 	}
 	return result
 }
+
+// PushMIDIEvent は、MIDIデバイスから受信したメッセージを ctrl に蓄積します。
+// ctrl が対応しない種類のメッセージは無視されます。
+func PushMIDIEvent(ctrl *fmfm.Controller, e MIDIEvent) {
+	pushMIDIEvent(ctrl, e, e.Status&15)
+}
+
+// pushMIDIEvent は、メッセージをMIDIチャンネル channel のものとして ctrl に蓄積します。
+func pushMIDIEvent(ctrl *fmfm.Controller, e MIDIEvent, channel int) {
+	var typ fmfm.MIDIMessage
+	switch e.Status & 0xf0 {
+	case 0x90:
+		typ = fmfm.MIDINoteOn
+	case 0x80:
+		typ = fmfm.MIDINoteOff
+	case 0xb0:
+		typ = fmfm.MIDIControlChange
+	case 0xc0:
+		typ = fmfm.MIDIProgramChange
+	case 0xe0:
+		typ = fmfm.MIDIPitchBend
+	default:
+		return
+	}
+	ctrl.PushMIDIMessage(typ, e.Timestamp, channel, e.Data1, e.Data2)
+}
@@ -0,0 +1,38 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMIDIPort(t *testing.T) {
+	port, err := ParseMIDIPort("Port A")
+	assert.NoError(t, err)
+	assert.Equal(t, MIDIPort{Device: "Port A", Channels: DefaultMIDIChannelRange}, port)
+
+	port, err = ParseMIDIPort("Port B:17-32")
+	assert.NoError(t, err)
+	assert.Equal(t, MIDIPort{Device: "Port B", Channels: MIDIChannelRange{First: 16, Last: 31}}, port)
+
+	port, err = ParseMIDIPort(":1-4")
+	assert.NoError(t, err)
+	assert.Equal(t, MIDIPort{Device: "", Channels: MIDIChannelRange{First: 0, Last: 3}}, port)
+
+	_, err = ParseMIDIPort("Port C:0-15")
+	assert.Error(t, err)
+	_, err = ParseMIDIPort("Port C:20-17")
+	assert.Error(t, err)
+}
+
+func TestMIDIChannelRange_Map(t *testing.T) {
+	r := MIDIChannelRange{First: 16, Last: 19}
+	ch, ok := r.Map(0)
+	assert.True(t, ok)
+	assert.Equal(t, 16, ch)
+	ch, ok = r.Map(3)
+	assert.True(t, ok)
+	assert.Equal(t, 19, ch)
+	_, ok = r.Map(4)
+	assert.False(t, ok)
+}
@@ -0,0 +1,219 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// smfDefaultTempo は、テンポが指定されていない場合の4分音符の長さ[μs]です。
+const smfDefaultTempo = 500000
+
+// smfEvent は、トラックから読み込んだイベントです。
+type smfEvent struct {
+	tick int64
+	// tempo は、テンポ変更のメタイベントの場合に、4分音符の長さ[μs]を表します。それ以外は 0 です。
+	tempo int64
+	event MIDIEvent
+}
+
+// ReadSMF は、スタンダードMIDIファイル (フォーマット0および1) を読み込み、
+// 全トラックのチャンネルメッセージを時刻順に並べて返します。
+// 各メッセージの Timestamp は、テンポ変更を反映した曲の先頭からの時刻[ms]です。
+// SysEx およびテンポ変更以外のメタイベントは読み飛ばします。
+func ReadSMF(r io.Reader) ([]MIDIEvent, error) {
+	br := bufio.NewReader(r)
+	id, data, err := readSMFChunk(br)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(data) < 6 {
+		return nil, errors.New("not a standard MIDI file")
+	}
+	format := binary.BigEndian.Uint16(data[0:])
+	tracks := int(binary.BigEndian.Uint16(data[2:]))
+	division := binary.BigEndian.Uint16(data[4:])
+	if 1 < format {
+		return nil, fmt.Errorf("unsupported SMF format: %d", format)
+	}
+	if division&0x8000 == 0 {
+		if division == 0 {
+			return nil, errors.New("invalid SMF division: 0 ticks per quarter note")
+		}
+	} else {
+		switch -int8(division >> 8) {
+		case 24, 25, 29, 30:
+		default:
+			return nil, fmt.Errorf("invalid SMF division: %d frames per second", -int8(division>>8))
+		}
+		if division&0xff == 0 {
+			return nil, errors.New("invalid SMF division: 0 ticks per frame")
+		}
+	}
+
+	events := []smfEvent{}
+	for 0 < tracks {
+		id, data, err := readSMFChunk(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if id != "MTrk" {
+			continue
+		}
+		trackEvents, err := parseSMFTrack(data)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, trackEvents...)
+		tracks--
+	}
+	// 同じ時刻のイベントはトラック順、トラック内の順に処理する
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].tick < events[j].tick
+	})
+
+	result := []MIDIEvent{}
+	var tick, us int64
+	tempo := int64(smfDefaultTempo)
+	for _, e := range events {
+		if division&0x8000 == 0 {
+			us += (e.tick - tick) * tempo / int64(division)
+		} else {
+			// SMPTE 形式の場合は、1秒あたりのフレーム数と1フレームあたりのティック数で時刻を表す
+			fps := -int64(int8(division >> 8))
+			us += (e.tick - tick) * 1000000 / (fps * int64(division&0xff))
+		}
+		tick = e.tick
+		if 0 < e.tempo {
+			tempo = e.tempo
+			continue
+		}
+		e.event.Timestamp = int(us / 1000)
+		result = append(result, e.event)
+	}
+	return result, nil
+}
+
+func readSMFChunk(r io.Reader) (string, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", nil, errors.New("unexpected end of SMF")
+		}
+		return "", nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[4:]))
+	data, err := ioutil.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) < size {
+		return "", nil, errors.New("unexpected end of SMF")
+	}
+	return string(header[:4]), data, nil
+}
+
+// parseSMFTrack は、トラックチャンクのデータを解析します。
+func parseSMFTrack(data []byte) ([]smfEvent, error) {
+	errEOT := errors.New("unexpected end of SMF track")
+	pos := 0
+	readByte := func() (int, error) {
+		if len(data) <= pos {
+			return 0, errEOT
+		}
+		pos++
+		return int(data[pos-1]), nil
+	}
+	readVarLen := func() (int64, error) {
+		var v int64
+		for i := 0; i < 4; i++ {
+			b, err := readByte()
+			if err != nil {
+				return 0, err
+			}
+			v = v<<7 | int64(b&0x7f)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, errors.New("invalid variable-length quantity in SMF track")
+	}
+
+	result := []smfEvent{}
+	var tick int64
+	status := 0
+	for pos < len(data) {
+		delta, err := readVarLen()
+		if err != nil {
+			return nil, err
+		}
+		tick += delta
+		b, err := readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case b == 0xff:
+			typ, err := readByte()
+			if err != nil {
+				return nil, err
+			}
+			size, err := readVarLen()
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(data)-pos) < size {
+				return nil, errEOT
+			}
+			body := data[pos : pos+int(size)]
+			pos += int(size)
+			switch typ {
+			case 0x2f:
+				return result, nil
+			case 0x51:
+				if len(body) == 3 {
+					tempo := int64(body[0])<<16 | int64(body[1])<<8 | int64(body[2])
+					if 0 < tempo {
+						result = append(result, smfEvent{tick: tick, tempo: tempo})
+					}
+				}
+			}
+			continue
+		case b == 0xf0, b == 0xf7:
+			size, err := readVarLen()
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(data)-pos) < size {
+				return nil, errEOT
+			}
+			pos += int(size)
+			status = 0
+			continue
+		case 0xf0 < b:
+			return nil, fmt.Errorf("unexpected system message in SMF track: %02x", b)
+		case 0x80 <= b:
+			status = b
+			if b, err = readByte(); err != nil {
+				return nil, err
+			}
+		case status == 0:
+			return nil, fmt.Errorf("unexpected data byte in SMF track: %02x", b)
+		}
+		e := MIDIEvent{Status: status, Data1: b}
+		if s := status & 0xf0; s != 0xc0 && s != 0xd0 {
+			if e.Data2, err = readByte(); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, smfEvent{tick: tick, event: e})
+	}
+	return result, nil
+}
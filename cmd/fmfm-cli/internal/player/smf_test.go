@@ -0,0 +1,58 @@
+package player
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSMF(t *testing.T) {
+	smf := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 2, 0x01, 0xe0, // フォーマット1, 2トラック, 480ティック/4分音符
+		// テンポ (4分音符 = 250ms) を含むコンダクタートラック
+		'M', 'T', 'r', 'k', 0, 0, 0, 15,
+		0x00, 0xff, 0x51, 0x03, 0x03, 0xd0, 0x90,
+		0x83, 0x60, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20, // 480ティック後に 4分音符 = 500ms
+		// ランニングステータスと SysEx を含むトラック
+		'M', 'T', 'r', 'k', 0, 0, 0, 21,
+		0x00, 0x91, 0x3c, 0x64,
+		0x83, 0x60, 0x3c, 0x00,
+		0x00, 0xf0, 0x02, 0x43, 0xf7,
+		0x83, 0x60, 0xc1, 0x05,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+	events, err := ReadSMF(bytes.NewReader(smf))
+	assert.NoError(t, err)
+	assert.Equal(t, []MIDIEvent{
+		{Timestamp: 0, Status: 0x91, Data1: 0x3c, Data2: 0x64},
+		{Timestamp: 250, Status: 0x91, Data1: 0x3c, Data2: 0x00},
+		{Timestamp: 750, Status: 0xc1, Data1: 0x05},
+	}, events)
+
+	_, err = ReadSMF(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00")))
+	assert.Error(t, err)
+	_, err = ReadSMF(bytes.NewReader(smf[:len(smf)-3]))
+	assert.Error(t, err)
+
+	// 分解能が 0 または SMPTE 形式のフレームレートが不正な場合は、除算せずにエラーとする
+	for _, division := range [][2]byte{{0x00, 0x00}, {0x80, 0x04}, {0xe7, 0x00}} {
+		header := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, division[0], division[1]}
+		track := []byte{
+			'M', 'T', 'r', 'k', 0, 0, 0, 9,
+			0x83, 0x60, 0x90, 0x3c, 0x64,
+			0x00, 0xff, 0x2f, 0x00,
+		}
+		_, err = ReadSMF(bytes.NewReader(append(header, track...)))
+		assert.Error(t, err, "division %02x%02x", division[0], division[1])
+	}
+
+	// チャンネルメッセージ以外のシステムメッセージはトラック中に現れない
+	for _, status := range []byte{0xf1, 0xf8, 0xfe} {
+		data := append([]byte{}, smf[:14]...)
+		data[11] = 1
+		data = append(data, 'M', 'T', 'r', 'k', 0, 0, 0, 6, 0x00, status, 0x00, 0xff, 0x2f, 0x00)
+		_, err = ReadSMF(bytes.NewReader(data))
+		assert.Error(t, err, "status %02x", status)
+	}
+}
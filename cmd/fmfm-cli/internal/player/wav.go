@@ -0,0 +1,73 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// wavHeaderSize は、WAV ファイルのヘッダの長さです。
+const wavHeaderSize = 44
+
+// WAVWriter は、左右の振幅を WAV ファイルとして書き出す PCMWriter です。
+type WAVWriter struct {
+	*PCMWriter
+	w io.WriteSeeker
+}
+
+// NewWAVWriter は、w にヘッダを書き出し、新しい WAVWriter を作成します。
+// ヘッダのデータ長は Close を呼び出した時点で確定します。
+func NewWAVWriter(w io.WriteSeeker, format PCMFormat, sampleRate float64) (*WAVWriter, error) {
+	// 1: 整数の PCM, 3: 浮動小数点数の PCM
+	tag, bits := uint16(1), uint16(16)
+	if format == PCMF32LE {
+		tag, bits = 3, 32
+	}
+	rate := uint32(sampleRate + .5)
+	blockAlign := 2 * bits / 8
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], wavHeaderSize-8)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], tag)
+	binary.LittleEndian.PutUint16(header[22:], 2)
+	binary.LittleEndian.PutUint32(header[24:], rate)
+	binary.LittleEndian.PutUint32(header[28:], rate*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], blockAlign)
+	binary.LittleEndian.PutUint16(header[34:], bits)
+	copy(header[36:], "data")
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &WAVWriter{
+		PCMWriter: NewPCMWriter(w, format),
+		w:         w,
+	}, nil
+}
+
+// Close は、バッファに残っているデータを書き出し、ヘッダのデータ長を更新します。
+// w は閉じません。
+func (ww *WAVWriter) Close() error {
+	if err := ww.Flush(); err != nil {
+		return err
+	}
+	end, err := ww.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var buf [4]byte
+	for _, field := range []struct{ offset, value int64 }{
+		{4, end - 8},
+		{40, end - wavHeaderSize},
+	} {
+		binary.LittleEndian.PutUint32(buf[:], uint32(field.value))
+		if _, err := ww.w.Seek(field.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ww.w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	_, err = ww.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,36 @@
+package player
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAVWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "fmfm-wav")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWAVWriter(f, PCMS16LE, 44100)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, w.Write(.5, -.5))
+	}
+	assert.NoError(t, w.Close())
+
+	data, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Len(t, data, wavHeaderSize+12)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, uint32(44100), binary.LittleEndian.Uint32(data[24:]))
+	assert.Equal(t, uint32(44100*4), binary.LittleEndian.Uint32(data[28:]))
+	assert.Equal(t, uint32(12), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, []byte{0x00, 0x40, 0x01, 0xc0}, data[44:48])
+}
@@ -2,16 +2,15 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
-	"time"
+	"os/signal"
+	"syscall"
 
 	fmfm "github.com/but80/fmfm.core"
 	"github.com/but80/fmfm.core/cmd/fmfm-cli/internal/player"
 	"github.com/but80/fmfm.core/sim"
+	"github.com/but80/fmfm.core/ymf"
 	"github.com/urfave/cli"
-	"gopkg.in/but80/go-smaf.v1/pb/smaf"
 )
 
 var version string
@@ -27,9 +26,40 @@ var listCmd = cli.Command{
 	Aliases:   []string{"l"},
 	Usage:     "List MIDI devices",
 	ArgsUsage: " ",
-	Flags:     []cli.Flag{},
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "audio, a",
+			Usage: `List audio output devices instead`,
+		},
+	},
 	Action: func(ctx *cli.Context) error {
-		devices := player.ListMIDIDeivces()
+		if ctx.Bool("audio") {
+			devices, err := player.ListAudioDevices()
+			if err != nil {
+				return err
+			}
+			for _, dev := range devices {
+				def := ""
+				if dev.Default {
+					def = " (default)"
+				}
+				fmt.Printf(
+					"%s > %s%s\t%dch %gHz latency:%s-%s\n",
+					dev.HostAPI,
+					dev.Name,
+					def,
+					dev.Channels,
+					dev.SampleRate,
+					dev.LowLatency,
+					dev.HighLatency,
+				)
+			}
+			return nil
+		}
+		devices, err := player.ListMIDIDeivces()
+		if err != nil {
+			return err
+		}
 		for _, dev := range devices {
 			fmt.Println(dev)
 		}
@@ -41,25 +71,13 @@ var midiCmd = cli.Command{
 	Name:      "midi",
 	Aliases:   []string{"m"},
 	Usage:     "Listen MIDI events",
-	ArgsUsage: "[<Input MIDI device>]",
-	Flags: []cli.Flag{
-		cli.BoolFlag{
-			Name:  "mono, m",
-			Usage: `Force mono mode in all MIDI channels except drum PC`,
-		},
-		cli.BoolFlag{
-			Name:  "mute-nopc, z",
-			Usage: `Mute if program change is not found`,
-		},
-		cli.Float64Flag{
-			Name:  "level, l",
-			Usage: `Total level in dB`,
-			Value: -12.0,
-		},
-		cli.Float64Flag{
-			Name:  "limiter, c",
-			Usage: `Limiter threshold in dB`,
-			Value: -6.0,
+	ArgsUsage: "[<Input MIDI device>[:<first channel>-<last channel>] ...]",
+	Flags: append(
+		append(synthFlags, audioFlags...),
+		cli.IntFlag{
+			Name:  "chips, C",
+			Usage: `Number of chips to share voices among`,
+			Value: 1,
 		},
 		cli.IntFlag{
 			Name:  "ignore, n",
@@ -77,27 +95,30 @@ var midiCmd = cli.Command{
 			Name:  "print, p",
 			Usage: `Print status`,
 		},
-	},
+	),
 	Action: func(ctx *cli.Context) error {
-		args := ctx.Args()
-		midiDevice := ""
-		if 1 <= ctx.NArg() {
-			midiDevice = args[0]
+		ports := []player.MIDIPort{}
+		midiChannels := fmfm.DefaultMIDIChannels
+		for _, arg := range ctx.Args() {
+			port, err := player.ParseMIDIPort(arg)
+			if err != nil {
+				return err
+			}
+			ports = append(ports, port)
+			if midiChannels <= port.Channels.Last {
+				midiChannels = port.Channels.Last + 1
+			}
+		}
+		if len(ports) == 0 {
+			ports = append(ports, player.MIDIPort{Channels: player.DefaultMIDIChannelRange})
+		}
+		if ctx.Int("chips") < 1 {
+			return fmt.Errorf("invalid number of chips: %d", ctx.Int("chips"))
 		}
 
-		info, err := ioutil.ReadDir("voice")
+		lib, err := loadVoiceLibrary("voice")
 		if err != nil {
-			panic(err)
-		}
-		var lib smaf.VM5VoiceLib
-		for _, i := range info {
-			if i.IsDir() || !strings.HasSuffix(i.Name(), ".vm5.pb") {
-				continue
-			}
-			err := lib.LoadFile("voice/" + i.Name())
-			if err != nil {
-				panic(err)
-			}
+			return err
 		}
 
 		dumpMIDIChannel := -1
@@ -105,40 +126,67 @@ var midiCmd = cli.Command{
 			dumpMIDIChannel = ctx.Int("dump") - 1
 		}
 
-		renderer := player.NewRenderer()
-		limiter := player.NewLimiter(renderer.Parameters.SampleRate)
-		limiter.SetThreshold(ctx.Float64("limiter"))
-		renderer.Insert(limiter)
-		chip := sim.NewChip(
-			renderer.Parameters.SampleRate,
-			ctx.Float64("level"),
-			dumpMIDIChannel,
-		)
-		regs := sim.NewRegisters(chip)
-		opts := &fmfm.ControllerOpts{
-			Registers:          regs,
-			Library:            &lib,
-			MuteIfPCNotFound:   ctx.Bool("mute-nopc"),
-			ForceMono:          ctx.Bool("mono"),
-			PrintStatus:        ctx.Bool("print"),
-			IgnoreMIDIChannels: []int{},
-			SoloMIDIChannel:    dumpMIDIChannel,
+		audioOpts, err := newAudioOutputOpts(ctx)
+		if err != nil {
+			return err
+		}
+		latency, err := schedulingLatency(ctx)
+		if err != nil {
+			return err
+		}
+
+		logger := ymf.DefaultLogger
+		renderer, err := player.NewRenderer(audioOpts, logger)
+		if err != nil {
+			return err
 		}
+		defer renderer.Close()
+		insertions, err := newInsertions(ctx, renderer.SampleRate())
+		if err != nil {
+			return err
+		}
+		for _, insertion := range insertions {
+			renderer.Insert(insertion)
+		}
+		chips := []player.Processor{}
+		registers := []ymf.Registers{}
+		for i := 0; i < ctx.Int("chips"); i++ {
+			chip, err := newChip(ctx, renderer.SampleRate(), dumpMIDIChannel, logger)
+			if err != nil {
+				return err
+			}
+			chips = append(chips, chip)
+			registers = append(registers, sim.NewRegisters(chip))
+		}
+		opts := newControllerOpts(ctx, ymf.NewMultiRegisters(registers...), lib, logger)
+		opts.MIDIChannels = midiChannels
+		opts.PrintStatus = ctx.Bool("print")
+		opts.SoloMIDIChannel = dumpMIDIChannel
 		if 0 < ctx.Int("ignore") {
 			opts.IgnoreMIDIChannels = append(opts.IgnoreMIDIChannels, ctx.Int("ignore")-1)
 		}
 		if 0 < ctx.Int("solo") {
-			for i := 0; i < 16; i++ {
+			for i := 0; i < midiChannels; i++ {
 				if i == ctx.Int("solo")-1 {
 					continue
 				}
 				opts.IgnoreMIDIChannels = append(opts.IgnoreMIDIChannels, i)
 			}
 		}
-		seq := player.NewSequencer(midiDevice, opts)
+		seq, err := player.NewSequencer(ports, opts)
+		if err != nil {
+			return err
+		}
 		defer seq.Close()
-		renderer.Start(chip.Next, seq.FlushMIDIMessages)
-		time.Sleep(24 * time.Hour)
+		renderer.SetMIDIClock(seq.Time).SetSchedulingLatency(latency)
+		processor := newProcessor(ctx, player.NewMixer(chips...), renderer.SampleRate())
+		if err := renderer.Start(processor, seq); err != nil {
+			return err
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
 		return nil
 	},
 }
@@ -157,11 +205,16 @@ func main() {
 	app.HelpName = "fmfm-cli"
 	app.Commands = []cli.Command{
 		midiCmd,
+		pipeCmd,
+		renderCmd,
 		listCmd,
 	}
 	app.Action = func(ctx *cli.Context) error {
 		cli.ShowAppHelp(ctx)
 		return nil
 	}
-	app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
 }
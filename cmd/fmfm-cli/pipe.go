@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	fmfm "github.com/but80/fmfm.core"
+	"github.com/but80/fmfm.core/cmd/fmfm-cli/internal/player"
+	"github.com/but80/fmfm.core/sim"
+	"github.com/urfave/cli"
+)
+
+// pipeBlockSize は、リアルタイム入力時に MIDIメッセージの受信を確認する間隔[サンプル]です。
+const pipeBlockSize = 256
+
+// pipeLead は、リアルタイム入力時に実時間より先行してレンダリングする時間[ms]です。
+const pipeLead = 100
+
+var pipeCmd = cli.Command{
+	Name:        "pipe",
+	Aliases:     []string{"p"},
+	Usage:       "Read MIDI messages from stdin and write PCM to stdout",
+	Description: "Raw MIDI bytes are live input paced to the wall clock. Use --timestamped for deterministic renders.",
+	ArgsUsage:   " ",
+	Flags: append(
+		synthFlags,
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: `Output sample format (s16le, f32le)`,
+			Value: "s16le",
+		},
+		cli.Float64Flag{
+			Name:  "rate, r",
+			Usage: `Output sample rate in Hz`,
+			Value: 48000,
+		},
+		cli.BoolFlag{
+			Name:  "timestamped, t",
+			Usage: `Read "<time in ms> <hex bytes>" lines instead of raw MIDI bytes, and render as fast as stdout accepts`,
+		},
+		cli.Float64Flag{
+			Name:  "tail, T",
+			Usage: `Seconds to keep rendering after the end of input`,
+			Value: 1.0,
+		},
+	),
+	Action: func(ctx *cli.Context) error {
+		format, err := player.ParsePCMFormat(ctx.String("format"))
+		if err != nil {
+			return err
+		}
+		sampleRate := ctx.Float64("rate")
+		if sampleRate <= 0 {
+			return fmt.Errorf("invalid sample rate: %g", sampleRate)
+		}
+
+		lib, err := loadVoiceLibrary("voice")
+		if err != nil {
+			return err
+		}
+
+		// 標準出力は波形の出力に使用するため、ログは標準エラー出力に表示する
+		logger := log.New(os.Stderr, "", 0)
+		chip, err := newChip(ctx, sampleRate, -1, logger)
+		if err != nil {
+			return err
+		}
+		insertions, err := newInsertions(ctx, sampleRate)
+		if err != nil {
+			return err
+		}
+		ctrl := fmfm.NewController(newControllerOpts(ctx, sim.NewRegisters(chip), lib, logger))
+		pipe := player.NewPipe(sampleRate, newProcessor(ctx, chip, sampleRate), ctrl, player.NewPCMWriter(os.Stdout, format))
+		for _, insertion := range insertions {
+			pipe.Insert(insertion)
+		}
+
+		if ctx.Bool("timestamped") {
+			scanner := bufio.NewScanner(os.Stdin)
+			for line := 1; scanner.Scan(); line++ {
+				e, ok, err := player.ParseMIDILine(scanner.Text())
+				if err != nil {
+					return fmt.Errorf("line %d: %s", line, err)
+				}
+				if !ok {
+					continue
+				}
+				if err := pipe.RenderUntil(e.Timestamp); err != nil {
+					return err
+				}
+				player.PushMIDIEvent(ctrl, e)
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+		} else {
+			input := player.NewReaderMIDIInput(os.Stdin, pipe.Now)
+			done := make(chan struct{})
+			go func() {
+				for e := range input.Events() {
+					player.PushMIDIEvent(ctrl, e)
+				}
+				close(done)
+			}()
+			// 生入力は受信した時点で処理するため、出力を実時間に合わせて進める
+			start := time.Now()
+		loop:
+			for {
+				select {
+				case <-done:
+					break loop
+				default:
+				}
+				if err := pipe.Render(pipeBlockSize); err != nil {
+					return err
+				}
+				if err := pipe.Flush(); err != nil {
+					return err
+				}
+				wait := time.Duration(pipe.Now()-pipeLead)*time.Millisecond - time.Since(start)
+				if 0 < wait {
+					time.Sleep(wait)
+				}
+			}
+			if err := input.Close(); err != nil {
+				return err
+			}
+		}
+
+		if err := pipe.Render(int(ctx.Float64("tail") * sampleRate)); err != nil {
+			return err
+		}
+		return pipe.Flush()
+	},
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	fmfm "github.com/but80/fmfm.core"
+	"github.com/but80/fmfm.core/cmd/fmfm-cli/internal/player"
+	"github.com/but80/fmfm.core/sim"
+	"github.com/urfave/cli"
+)
+
+var renderCmd = cli.Command{
+	Name:      "render",
+	Aliases:   []string{"r"},
+	Usage:     "Render a standard MIDI file to WAV",
+	ArgsUsage: "<Input SMF> <Output WAV>",
+	Flags: append(
+		synthFlags,
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: `Output sample format (s16le, f32le)`,
+			Value: "s16le",
+		},
+		cli.Float64Flag{
+			Name:  "rate, r",
+			Usage: `Output sample rate in Hz`,
+			Value: 48000,
+		},
+		cli.Float64Flag{
+			Name:  "tail, T",
+			Usage: `Seconds to keep rendering after the last MIDI message`,
+			Value: 1.0,
+		},
+		cli.BoolFlag{
+			Name:  "stems, S",
+			Usage: `Also write the dry output of each used MIDI channel to "<Output WAV>.chNN.wav" (cannot be used with --effects)`,
+		},
+	),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			return fmt.Errorf("input SMF and output WAV must be specified")
+		}
+		format, err := player.ParsePCMFormat(ctx.String("format"))
+		if err != nil {
+			return err
+		}
+		sampleRate := ctx.Float64("rate")
+		if sampleRate <= 0 {
+			return fmt.Errorf("invalid sample rate: %g", sampleRate)
+		}
+		if ctx.Bool("stems") && ctx.Bool("effects") {
+			return fmt.Errorf("--stems cannot be used with --effects: reverb and chorus are not rendered per MIDI channel")
+		}
+
+		input, err := os.Open(ctx.Args()[0])
+		if err != nil {
+			return err
+		}
+		events, err := player.ReadSMF(input)
+		input.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", ctx.Args()[0], err)
+		}
+
+		lib, err := loadVoiceLibrary("voice")
+		if err != nil {
+			return err
+		}
+
+		logger := log.New(os.Stderr, "", 0)
+		chip, err := newChip(ctx, sampleRate, -1, logger)
+		if err != nil {
+			return err
+		}
+		insertions, err := newInsertions(ctx, sampleRate)
+		if err != nil {
+			return err
+		}
+		ctrl := fmfm.NewController(newControllerOpts(ctx, sim.NewRegisters(chip), lib, logger))
+
+		path := ctx.Args()[1]
+		files := []*os.File{}
+		defer func() {
+			for _, f := range files {
+				f.Close()
+			}
+		}()
+		writers := []*player.WAVWriter{}
+		create := func(path string) (*player.WAVWriter, error) {
+			f, err := os.Create(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+			w, err := player.NewWAVWriter(f, format, sampleRate)
+			if err != nil {
+				return nil, err
+			}
+			writers = append(writers, w)
+			return w, nil
+		}
+
+		output, err := create(path)
+		if err != nil {
+			return err
+		}
+		pipe := player.NewPipe(sampleRate, newProcessor(ctx, chip, sampleRate), ctrl, output.PCMWriter)
+		for _, insertion := range insertions {
+			pipe.Insert(insertion)
+		}
+		if ctx.Bool("stems") {
+			stems := make([]*player.PCMWriter, ctrl.MIDIChannelCount())
+			base := strings.TrimSuffix(path, filepath.Ext(path))
+			for _, e := range events {
+				m := e.Status & 15
+				if e.Status&0xf0 != 0x90 || e.Data2 == 0 || stems[m] != nil {
+					continue
+				}
+				stem, err := create(fmt.Sprintf("%s.ch%02d.wav", base, m+1))
+				if err != nil {
+					return err
+				}
+				stems[m] = stem.PCMWriter
+			}
+			if err := pipe.SetStems(stems); err != nil {
+				return err
+			}
+		}
+
+		for _, e := range events {
+			if err := pipe.RenderUntil(e.Timestamp); err != nil {
+				return err
+			}
+			player.PushMIDIEvent(ctrl, e)
+		}
+		if err := pipe.Render(int(ctx.Float64("tail") * sampleRate)); err != nil {
+			return err
+		}
+		if err := pipe.Flush(); err != nil {
+			return err
+		}
+		for _, w := range writers {
+			if err := w.Close(); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		files = nil
+		return nil
+	},
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	fmfm "github.com/but80/fmfm.core"
+	"github.com/but80/fmfm.core/cmd/fmfm-cli/internal/player"
+	"github.com/but80/fmfm.core/effect"
+	"github.com/but80/fmfm.core/sim"
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/urfave/cli"
+	"gopkg.in/but80/go-smaf.v1/pb/smaf"
+)
+
+// synthFlags は、音源を使用するコマンドに共通のオプションです。
+var synthFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "mono, m",
+		Usage: `Force mono mode in all MIDI channels except drum PC`,
+	},
+	cli.BoolFlag{
+		Name:  "mute-nopc, z",
+		Usage: `Mute if program change is not found`,
+	},
+	cli.Float64Flag{
+		Name:  "level, l",
+		Usage: `Total level in dB`,
+		Value: -12.0,
+	},
+	cli.Float64Flag{
+		Name:  "limiter, c",
+		Usage: `Limiter threshold in dB`,
+		Value: -6.0,
+	},
+	cli.StringFlag{
+		Name:  "profile, P",
+		Usage: `Emulation profile (ma5, ymf825, ideal)`,
+		Value: "ma5",
+	},
+	cli.IntFlag{
+		Name:  "oversampling, O",
+		Usage: `Internal oversampling factor (1, 2, 4)`,
+		Value: 1,
+	},
+	cli.BoolFlag{
+		Name:  "native, N",
+		Usage: `Run the chip at its native 48kHz rate and resample the output`,
+	},
+	cli.BoolFlag{
+		Name:  "bandlimited, B",
+		Usage: `Use band-limited waveform tables to reduce aliasing`,
+	},
+	cli.BoolFlag{
+		Name:  "effects, E",
+		Usage: `Apply reverb and chorus sent by CC#91 and CC#93`,
+	},
+	cli.StringFlag{
+		Name:  "eq, e",
+		Usage: `Parametric EQ bands ("<type>:<Hz>[:<dB>[:<Q>]],...", type: peak, lowshelf, highshelf, lowcut, highcut)`,
+	},
+	cli.StringFlag{
+		Name:  "compressor, x",
+		Usage: `Compressor ("<threshold dB>:<ratio>[:<attack ms>[:<release ms>[:<makeup dB>]]][@<crossover Hz>,...]")`,
+	},
+	cli.StringFlag{
+		Name:  "handset, K",
+		Usage: `Emulate a mobile phone speaker (off, stereo, mono)`,
+		Value: "off",
+	},
+	cli.IntFlag{
+		Name:  "handset-bits, Q",
+		Usage: `DAC resolution of the emulated mobile phone in bits (0: unlimited)`,
+	},
+}
+
+// loadVoiceLibrary は、dir 以下の音色ライブラリ (*.vm5.pb) をすべて読み込みます。
+func loadVoiceLibrary(dir string) (*smaf.VM5VoiceLib, error) {
+	info, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read voice directory: %s", err)
+	}
+	var lib smaf.VM5VoiceLib
+	for _, i := range info {
+		if i.IsDir() || !strings.HasSuffix(i.Name(), ".vm5.pb") {
+			continue
+		}
+		path := filepath.Join(dir, i.Name())
+		if err := lib.LoadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %s", path, err)
+		}
+	}
+	return &lib, nil
+}
+
+// newChip は、synthFlags に従って新しい sim.Chip を作成します。
+func newChip(ctx *cli.Context, sampleRate float64, dumpMIDIChannel int, logger ymf.Logger) (*sim.Chip, error) {
+	profile, ok := sim.FindProfile(ctx.String("profile"))
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", ctx.String("profile"))
+	}
+	switch ctx.Int("oversampling") {
+	case 1, 2, 4:
+	default:
+		return nil, fmt.Errorf("invalid oversampling factor: %d (must be 1, 2 or 4)", ctx.Int("oversampling"))
+	}
+	chip := sim.NewChip(
+		sampleRate,
+		ctx.Float64("level"),
+		dumpMIDIChannel,
+		profile,
+	).SetOversampling(ctx.Int("oversampling")).SetNativeRate(ctx.Bool("native")).
+		SetBandLimited(ctx.Bool("bandlimited")).SetLogger(logger)
+	return chip, nil
+}
+
+// newInsertions は、synthFlags に従って、出力に適用するインサーションエフェクトを順に並べて返します。
+func newInsertions(ctx *cli.Context, sampleRate float64) ([]player.Insertion, error) {
+	result := []player.Insertion{}
+	if ctx.String("eq") != "" {
+		eq, err := effect.ParseEQ(sampleRate, ctx.String("eq"))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, eq)
+	}
+	if ctx.String("compressor") != "" {
+		comp, err := effect.ParseCompressor(sampleRate, ctx.String("compressor"))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, comp)
+	}
+	switch ctx.String("handset") {
+	case "off":
+	case "stereo", "mono":
+		handset := player.NewHandset(sampleRate).
+			SetMono(ctx.String("handset") == "mono").
+			SetBits(ctx.Int("handset-bits"))
+		result = append(result, handset)
+	default:
+		return nil, fmt.Errorf("unknown handset mode: %s", ctx.String("handset"))
+	}
+	result = append(result, player.NewLimiter(sampleRate).SetThreshold(ctx.Float64("limiter")))
+	return result, nil
+}
+
+// newProcessor は、synthFlags に従って、processor に必要に応じてセンドエフェクトを加えた player.Processor を作成します。
+func newProcessor(ctx *cli.Context, processor player.SendProcessor, sampleRate float64) player.Processor {
+	if !ctx.Bool("effects") {
+		return processor
+	}
+	return player.NewSendEffects(processor).
+		SetEffect(sim.SendReverb, player.NewReverb(sampleRate)).
+		SetEffect(sim.SendChorus, player.NewChorus(sampleRate))
+}
+
+// newControllerOpts は、synthFlags に従って registers をコントロールする fmfm.ControllerOpts を作成します。
+func newControllerOpts(ctx *cli.Context, registers ymf.Registers, lib *smaf.VM5VoiceLib, logger ymf.Logger) *fmfm.ControllerOpts {
+	return &fmfm.ControllerOpts{
+		Registers:          registers,
+		Library:            lib,
+		MuteIfPCNotFound:   ctx.Bool("mute-nopc"),
+		ForceMono:          ctx.Bool("mono"),
+		IgnoreMIDIChannels: []int{},
+		SoloMIDIChannel:    -1,
+		Logger:             logger,
+	}
+}
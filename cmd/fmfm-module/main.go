@@ -3,13 +3,15 @@ package main
 import "C"
 
 import (
-	"fmt"
 	"io/ioutil"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	fmfm "github.com/but80/fmfm.core"
+	"github.com/but80/fmfm.core/effect"
 	"github.com/but80/fmfm.core/sim"
+	"github.com/but80/fmfm.core/ymf"
 	"github.com/golang/protobuf/proto"
 	"gopkg.in/but80/go-smaf.v1/pb/smaf"
 )
@@ -23,13 +25,42 @@ var chip *sim.Chip
 var ctrl *fmfm.Controller
 var initOnce sync.Once
 
+// logger は、エラーや音源の動作状況を出力する Logger です。
+var logger = ymf.DefaultLogger
+
+// effectChain は、出力に適用するエフェクトの組です。無効のエフェクトは nil です。
+type effectChain struct {
+	eq   *effect.EQ
+	comp *effect.Compressor
+}
+
+// effects は、現在の *effectChain を保持します。
+// FMFMNext がサンプルごとにロックを取らずに済むよう、設定時は新しい effectChain に差し替えます。
+var effects atomic.Value
+
+// effectsMutex は、effects を差し替える処理同士を排他します。
+var effectsMutex sync.Mutex
+
+func init() {
+	effects.Store(&effectChain{})
+}
+
+// updateEffects は、現在の effectChain の複製に update を適用し、effects を差し替えます。
+func updateEffects(update func(chain *effectChain)) {
+	effectsMutex.Lock()
+	defer effectsMutex.Unlock()
+	chain := *effects.Load().(*effectChain)
+	update(&chain)
+	effects.Store(&chain)
+}
+
 // FMFMLoadLibrary は、ライブラリをロードします。
 //export FMFMLoadLibrary
 func FMFMLoadLibrary(voicePath *C.char) C.int {
 	voicePathGo := C.GoString(voicePath)
 	info, err := ioutil.ReadDir(voicePathGo)
 	if err != nil {
-		fmt.Println(err.Error())
+		logger.Printf("%s", err)
 		return 0
 	}
 	for _, i := range info {
@@ -38,7 +69,7 @@ func FMFMLoadLibrary(voicePath *C.char) C.int {
 		}
 		err := lib.LoadFile(voicePathGo + "/" + i.Name())
 		if err != nil {
-			fmt.Println(err.Error())
+			logger.Printf("%s", err)
 			return 0
 		}
 	}
@@ -50,11 +81,12 @@ func FMFMLoadLibrary(voicePath *C.char) C.int {
 func FMFMInit(sampleRate C.double) C.int {
 	result := 0
 	initOnce.Do(func() {
-		chip = sim.NewChip(float64(sampleRate), -15.0, -1)
+		chip = sim.NewChip(float64(sampleRate), -15.0, -1, nil).SetLogger(logger)
 		regs := sim.NewRegisters(chip)
 		opts := &fmfm.ControllerOpts{
 			Registers: regs,
 			Library:   &lib,
+			Logger:    logger,
 		}
 		ctrl = fmfm.NewController(opts)
 		result = 1
@@ -152,7 +184,7 @@ func FMFMGetVoice(out *C.uchar, msb, lsb, pc, drumNote C.longlong) C.longlong {
 		if p.BankMsb == uint32(msb) && p.BankLsb == uint32(lsb) && p.Pc == uint32(pc) {
 			data, err := proto.Marshal(p)
 			if err != nil {
-				fmt.Println(err.Error())
+				logger.Printf("%s", err)
 				return 0
 			}
 			return writeBytes(out, data)
@@ -161,9 +193,62 @@ func FMFMGetVoice(out *C.uchar, msb, lsb, pc, drumNote C.longlong) C.longlong {
 	return 0
 }
 
+// FMFMSetEQ は、出力に適用するパラメトリックイコライザを設定します。
+// spec の形式は effect.ParseEQ と同じで、空の文字列の場合はイコライザを無効にします。
+//export FMFMSetEQ
+func FMFMSetEQ(spec *C.char) C.int {
+	if chip == nil {
+		return 0
+	}
+	specGo := C.GoString(spec)
+	var e *effect.EQ
+	if specGo != "" {
+		var err error
+		e, err = effect.ParseEQ(chip.SampleRate(), specGo)
+		if err != nil {
+			logger.Printf("invalid EQ spec: %s", err)
+			return 0
+		}
+	}
+	updateEffects(func(chain *effectChain) {
+		chain.eq = e
+	})
+	return 1
+}
+
+// FMFMSetCompressor は、出力に適用するコンプレッサーを設定します。
+// spec の形式は effect.ParseCompressor と同じで、空の文字列の場合はコンプレッサーを無効にします。
+//export FMFMSetCompressor
+func FMFMSetCompressor(spec *C.char) C.int {
+	if chip == nil {
+		return 0
+	}
+	specGo := C.GoString(spec)
+	var c *effect.Compressor
+	if specGo != "" {
+		var err error
+		c, err = effect.ParseCompressor(chip.SampleRate(), specGo)
+		if err != nil {
+			logger.Printf("invalid compressor spec: %s", err)
+			return 0
+		}
+	}
+	updateEffects(func(chain *effectChain) {
+		chain.comp = c
+	})
+	return 1
+}
+
 // FMFMNext は、次のサンプルを生成・取得します。
 //export FMFMNext
 func FMFMNext() (C.double, C.double) {
 	l, r := chip.Next()
+	chain := effects.Load().(*effectChain)
+	if chain.eq != nil {
+		l, r = chain.eq.Next(l, r)
+	}
+	if chain.comp != nil {
+		l, r = chain.comp.Next(l, r)
+	}
 	return C.double(l), C.double(r)
 }
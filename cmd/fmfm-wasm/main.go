@@ -5,6 +5,7 @@ import (
 	"syscall/js"
 
 	fmfm "github.com/but80/fmfm.core"
+	"github.com/but80/fmfm.core/effect"
 	"github.com/but80/fmfm.core/sim"
 	"gopkg.in/but80/go-smaf.v1/pb/smaf"
 )
@@ -15,6 +16,13 @@ var (
 	ctrl     *fmfm.Controller
 	initOnce sync.Once
 	wait     = make(chan struct{})
+
+	// renderBufL, renderBufR は、fmfmRender で生成した波形を保持するバッファです。
+	renderBufL, renderBufR []float64
+
+	// eq, comp は、出力に適用するエフェクトです。無効の場合は nil です。
+	eq   *effect.EQ
+	comp *effect.Compressor
 )
 
 // // fmfmLoadLibrary は、ライブラリをロードします。
@@ -45,7 +53,7 @@ func fmfmInit(this js.Value, args []js.Value) interface{} {
 	}
 	sampleRate := args[0].Float()
 	initOnce.Do(func() {
-		chip = sim.NewChip(sampleRate, -15.0, -1)
+		chip = sim.NewChip(sampleRate, -15.0, -1, nil)
 		regs := sim.NewRegisters(chip)
 		opts := &fmfm.ControllerOpts{
 			Registers: regs,
@@ -129,14 +137,63 @@ func fmfmRender(this js.Value, args []js.Value) interface{} {
 	size := args[2].Int()
 	now := args[3].Float()
 	delta := 1000.0 / chip.SampleRate()
+	if len(renderBufL) < size {
+		renderBufL = make([]float64, size)
+		renderBufR = make([]float64, size)
+	}
+	ctrl.ScheduleBlock(size, func(i int) int {
+		return int(now + float64(i)*delta)
+	}, func(from, to int) {
+		chip.Render(renderBufL[from:to], renderBufR[from:to])
+	})
 	for i := 0; i < size; i++ {
-		ctrl.FlushMIDIMessages(int(now))
-		now += delta
-		l, r := chip.Next()
+		l, r := renderBufL[i], renderBufR[i]
+		if eq != nil {
+			l, r = eq.Next(l, r)
+		}
+		if comp != nil {
+			l, r = comp.Next(l, r)
+		}
 		outL.SetIndex(i, l)
 		outR.SetIndex(i, r)
 	}
-	return now
+	return now + float64(size)*delta
+}
+
+// fmfmSetEQ は、出力に適用するパラメトリックイコライザを設定します。
+// 引数の形式は effect.ParseEQ と同じで、空の文字列の場合はイコライザを無効にします。
+func fmfmSetEQ(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 || chip == nil {
+		return false
+	}
+	if args[0].String() == "" {
+		eq = nil
+		return true
+	}
+	e, err := effect.ParseEQ(chip.SampleRate(), args[0].String())
+	if err != nil {
+		return false
+	}
+	eq = e
+	return true
+}
+
+// fmfmSetCompressor は、出力に適用するコンプレッサーを設定します。
+// 引数の形式は effect.ParseCompressor と同じで、空の文字列の場合はコンプレッサーを無効にします。
+func fmfmSetCompressor(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 || chip == nil {
+		return false
+	}
+	if args[0].String() == "" {
+		comp = nil
+		return true
+	}
+	c, err := effect.ParseCompressor(chip.SampleRate(), args[0].String())
+	if err != nil {
+		return false
+	}
+	comp = c
+	return true
 }
 
 // fmfmExit は、このサービスを終了します。
@@ -154,6 +211,8 @@ func main() {
 	js.Global().Set("fmfmProgramChange", js.FuncOf(fmfmProgramChange))
 	js.Global().Set("fmfmPitchBend", js.FuncOf(fmfmPitchBend))
 	js.Global().Set("fmfmRender", js.FuncOf(fmfmRender))
+	js.Global().Set("fmfmSetEQ", js.FuncOf(fmfmSetEQ))
+	js.Global().Set("fmfmSetCompressor", js.FuncOf(fmfmSetCompressor))
 	js.Global().Set("fmfmExit", js.FuncOf(fmfmExit))
 	<-wait
 }
@@ -3,6 +3,8 @@ package fmfm
 import (
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -73,8 +75,8 @@ const (
 	ccDataEntryLo  = 38
 	ccSustainPedal = 64
 	// ccSoftPedal    = 67
-	// ccReverb       = 91
-	// ccChorus       = 93
+	ccReverb    = 91
+	ccChorus    = 93
 	ccNRPNLo    = 98
 	ccNRPNHi    = 99
 	ccRPNLo     = 100
@@ -86,6 +88,7 @@ const (
 )
 
 type chipChannelState struct {
+	chip        int
 	midiChannel int
 	note        int
 	realnote    int
@@ -104,6 +107,8 @@ type midiChannelState struct {
 	volume              uint8
 	expression          uint8
 	pan                 uint8
+	reverb              uint8
+	chorus              uint8
 	pitch               int8
 	sustain             uint8
 	modulation          uint8
@@ -122,6 +127,29 @@ type ControllerOpts struct {
 	PrintStatus        bool
 	IgnoreMIDIChannels []int
 	SoloMIDIChannel    int
+	// ChipAffinity は、MIDIチャンネルごとに発音に使用する音源チップの番号です。
+	// Registers が複数の音源チップを束ねる ymf.MultiRegisters の場合に使用します。
+	// 指定のないMIDIチャンネルは、全音源チップのチャンネルを使用します。
+	// 存在しない音源チップを指定したMIDIチャンネルも全音源チップのチャンネルを使用し、
+	// そのことを EventInvalidChipAffinity として Observer に通知します。
+	ChipAffinity map[int]int
+	// MIDIChannels は、MIDIチャンネルの数です。指定のない場合は 16 です。
+	// 複数のMIDI入力を異なるMIDIチャンネルの範囲に割り当てる場合に、16 より大きな値を指定します。
+	MIDIChannels int
+	// Observer は、ノートの割り当てや破棄などのイベントを受け取ります。
+	// 指定のない場合は、警告となるイベントを Logger に出力します。
+	Observer Observer
+	// Logger は、ステータス表示や警告の出力先です。
+	// 指定のない場合は ymf.DefaultLogger を使用します。
+	Logger ymf.Logger
+}
+
+// DefaultMIDIChannels は、ControllerOpts.MIDIChannels を指定しない場合のMIDIチャンネルの数です。
+const DefaultMIDIChannels = 16
+
+// chipIndexer は、チャンネルを備える音源チップの番号を返すことのできる ymf.Registers です。
+type chipIndexer interface {
+	ChipIndex(channel int) int
 }
 
 // Controller は、MIDIに類似するインタフェースで Chip のレジスタをコントロールします。
@@ -134,10 +162,14 @@ type Controller struct {
 	debugPrintStatus   bool
 	ignoreMIDIChannels map[int]struct{}
 	soloMIDIChannel    int
+	chipAffinity       map[int]int
+	observer           Observer
+	logger             ymf.Logger
+	midiQueue          *midiQueue
 	midiMessages       []*midiMessage
 
-	midiChannelStates [16]*midiChannelState
-	chipChannelStates [ymfdata.ChannelCount]*chipChannelState
+	midiChannelStates []*midiChannelState
+	chipChannelStates []*chipChannelState
 }
 
 // NewController は、新しい Controller を作成します。
@@ -150,13 +182,54 @@ func NewController(opts *ControllerOpts) *Controller {
 		debugPrintStatus:   opts.PrintStatus,
 		ignoreMIDIChannels: map[int]struct{}{},
 		soloMIDIChannel:    opts.SoloMIDIChannel,
+		chipAffinity:       map[int]int{},
+		observer:           opts.Observer,
+		logger:             opts.Logger,
+		midiQueue:          newMIDIQueue(),
 		midiMessages:       []*midiMessage{},
+		chipChannelStates:  make([]*chipChannelState, opts.Registers.ChannelCount()),
+	}
+	midiChannels := opts.MIDIChannels
+	if midiChannels <= 0 {
+		midiChannels = DefaultMIDIChannels
+	}
+	ctrl.midiChannelStates = make([]*midiChannelState, midiChannels)
+	if ctrl.logger == nil {
+		ctrl.logger = ymf.DefaultLogger
+	}
+	if ctrl.observer == nil {
+		ctrl.observer = logObserver{logger: ctrl.logger}
 	}
 	for _, ch := range opts.IgnoreMIDIChannels {
 		ctrl.ignoreMIDIChannels[ch] = struct{}{}
 	}
+	indexer, _ := opts.Registers.(chipIndexer)
+	chips := map[int]struct{}{}
 	for i := range ctrl.chipChannelStates {
 		ctrl.chipChannelStates[i] = &chipChannelState{}
+		if indexer != nil {
+			ctrl.chipChannelStates[i].chip = indexer.ChipIndex(i)
+		}
+		chips[ctrl.chipChannelStates[i].chip] = struct{}{}
+	}
+	affinityChannels := []int{}
+	for midich := range opts.ChipAffinity {
+		affinityChannels = append(affinityChannels, midich)
+	}
+	sort.Ints(affinityChannels)
+	for _, midich := range affinityChannels {
+		chip := opts.ChipAffinity[midich]
+		if _, ok := chips[chip]; !ok {
+			ctrl.observer.Observe(&Event{
+				Type:        EventInvalidChipAffinity,
+				MIDIChannel: midich,
+				Note:        -1,
+				ChipChannel: -1,
+				Chip:        chip,
+			})
+			continue
+		}
+		ctrl.chipAffinity[midich] = chip
 	}
 	for i := range ctrl.midiChannelStates {
 		ctrl.midiChannelStates[i] = &midiChannelState{}
@@ -165,32 +238,40 @@ func NewController(opts *ControllerOpts) *Controller {
 	return ctrl
 }
 
+// MIDIChannelCount は、MIDIチャンネルの数を返します。
+func (ctrl *Controller) MIDIChannelCount() int {
+	return len(ctrl.midiChannelStates)
+}
+
 // PushMIDIMessage は、処理すべきMIDIメッセージを追加します。
+// 複数のゴルーチンから同時に呼び出すことができます。ロックを取得しないため、
+// FlushMIDIMessages や ScheduleBlock を呼び出す音声処理のゴルーチンをブロックすることはありません。
 func (ctrl *Controller) PushMIDIMessage(typ MIDIMessage, timestamp, midich, data1, data2 int) {
-	ctrl.mutex.Lock()
-	defer ctrl.mutex.Unlock()
-
-	msg := &midiMessage{
+	ctrl.midiQueue.push(&midiMessage{
 		typ:         typ,
 		timestamp:   timestamp,
 		midiChannel: midich,
 		data1:       data1,
 		data2:       data2,
-	}
-	n := len(ctrl.midiMessages)
-	for i := n; 0 < i; i-- {
-		if timestamp < ctrl.midiMessages[i-1].timestamp {
-			continue
+	})
+}
+
+// receiveMIDIMessages は、キューに追加されたMIDIメッセージを、時刻順に並べて midiMessages に移します。
+// 同じ時刻のメッセージは追加された順に並びます。
+func (ctrl *Controller) receiveMIDIMessages() {
+	for {
+		msg := ctrl.midiQueue.pop()
+		if msg == nil {
+			return
 		}
-		if i == n {
-			ctrl.midiMessages = append(ctrl.midiMessages, msg)
-		} else {
-			ctrl.midiMessages = append(ctrl.midiMessages[:i+1], ctrl.midiMessages[i:]...)
-			ctrl.midiMessages[i] = msg
+		i := len(ctrl.midiMessages)
+		for 0 < i && msg.timestamp < ctrl.midiMessages[i-1].timestamp {
+			i--
 		}
-		return
+		ctrl.midiMessages = append(ctrl.midiMessages, nil)
+		copy(ctrl.midiMessages[i+1:], ctrl.midiMessages[i:])
+		ctrl.midiMessages[i] = msg
 	}
-	ctrl.midiMessages = append([]*midiMessage{msg}, ctrl.midiMessages...)
 }
 
 var lastPrintedAt = time.Time{}
@@ -200,12 +281,48 @@ func (ctrl *Controller) FlushMIDIMessages(until int) {
 	ctrl.mutex.Lock()
 	defer ctrl.mutex.Unlock()
 
+	ctrl.flushMIDIMessages(until)
+	ctrl.printStatusIfNeeded()
+}
+
+// ScheduleBlock は、n サンプルのブロックを、蓄積されたMIDIメッセージの時刻で分割して処理します。
+// timeAt は、ブロック内の i 番目のサンプルの時刻[ms]を返す、単調非減少な関数です。
+// 各区間について、先頭のサンプルの時刻までのMIDIメッセージを処理した後、
+// 区間内のサンプルを生成するために render(from, to) が呼び出されます。
+// サンプルごとに FlushMIDIMessages を呼び出す場合と同じタイミングでMIDIメッセージが処理されますが、
+// ロックを取得するのは区間ごとの1回のみです。
+func (ctrl *Controller) ScheduleBlock(n int, timeAt func(i int) int, render func(from, to int)) {
+	for from := 0; from < n; {
+		ctrl.mutex.Lock()
+		ctrl.flushMIDIMessages(timeAt(from))
+		to := n
+		if 0 < len(ctrl.midiMessages) {
+			next := ctrl.midiMessages[0].timestamp
+			to = from + 1 + sort.Search(n-from-1, func(k int) bool {
+				return next <= timeAt(from+1+k)
+			})
+		}
+		if from == 0 {
+			ctrl.printStatusIfNeeded()
+		}
+		ctrl.mutex.Unlock()
+
+		render(from, to)
+		from = to
+	}
+}
+
+func (ctrl *Controller) flushMIDIMessages(until int) {
+	ctrl.receiveMIDIMessages()
 	var rest []*midiMessage
 	for i, msg := range ctrl.midiMessages {
 		if until < msg.timestamp {
 			rest = ctrl.midiMessages[i:]
 			break
 		}
+		if msg.midiChannel < 0 || len(ctrl.midiChannelStates) <= msg.midiChannel {
+			continue
+		}
 		// fmt.Printf("%02d: %d\n", msg.midiChannel, until - msg.timestamp)
 		switch msg.typ {
 		case MIDINoteOn:
@@ -221,7 +338,9 @@ func (ctrl *Controller) FlushMIDIMessages(until int) {
 		}
 	}
 	ctrl.midiMessages = rest
+}
 
+func (ctrl *Controller) printStatusIfNeeded() {
 	if ctrl.debugPrintStatus {
 		now := time.Now()
 		if time.Millisecond*10 <= now.Sub(lastPrintedAt) {
@@ -233,54 +352,115 @@ func (ctrl *Controller) FlushMIDIMessages(until int) {
 
 var notes = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
 
-func (ctrl *Controller) printStatus() {
-	fmt.Println("")
-	fmt.Println("Ch MSB-LSB-@PC Instrument       P Vol Exp Pan Vo Note")
+// MIDIChannelSnapshot は、MIDIチャンネルの状態のスナップショットです。
+type MIDIChannelSnapshot struct {
+	// MIDIChannel は、MIDIチャンネル番号です。
+	MIDIChannel int
+	// BankMSB, BankLSB, Program は、選択されている音色のバンクとプログラム番号です。
+	BankMSB, BankLSB, Program int
+	// Instrument は、最後に発音した音色の名前です。
+	Instrument string
+	// Volume, Expression, Pan, Modulation, Reverb, Chorus は、各コントロールチェンジの値です。
+	Volume, Expression, Pan, Modulation, Reverb, Chorus int
+	// PitchBend は、ピッチベンドの上位7bitの値です。中央は 64 です。
+	PitchBend int
+	// Sustain は、サステインペダルが踏まれているかどうかです。
+	Sustain bool
+	// Mono は、モノモードであるかどうかです。
+	Mono bool
+	// Voices は、このMIDIチャンネルに割り当てられている音源チャンネルの数です。
+	Voices int
+	// Notes は、割り当てられている音源チャンネルのノート番号を、割り当てた順に並べたものです。
+	Notes []int
+}
+
+// MIDIChannelSnapshots は、全MIDIチャンネルの現在の状態を返します。
+func (ctrl *Controller) MIDIChannelSnapshots() []MIDIChannelSnapshot {
+	ctrl.mutex.Lock()
+	defer ctrl.mutex.Unlock()
+	return ctrl.midiChannelSnapshots()
+}
+
+func (ctrl *Controller) midiChannelSnapshots() []MIDIChannelSnapshot {
+	result := make([]MIDIChannelSnapshot, len(ctrl.midiChannelStates))
 	for i, ms := range ctrl.midiChannelStates {
-		cs := &chipChannelState{}
-		voices := 0
-		lastTime := time.Time{}
+		voices := []*chipChannelState{}
 		for _, s := range ctrl.chipChannelStates {
 			if s.midiChannel == i {
-				voices++
-				if s.time.After(lastTime) {
-					cs = s
-					lastTime = s.time
-				}
+				voices = append(voices, s)
 			}
 		}
+		sort.SliceStable(voices, func(a, b int) bool {
+			return voices[a].time.Before(voices[b].time)
+		})
+		notes := make([]int, len(voices))
+		for j, s := range voices {
+			notes[j] = s.note
+		}
+
+		instrument := ""
+		if ms.debugLastInstrument != nil {
+			instrument = ms.debugLastInstrument.Name
+		}
+		result[i] = MIDIChannelSnapshot{
+			MIDIChannel: i,
+			BankMSB:     int(ms.bankMSB),
+			BankLSB:     int(ms.bankLSB),
+			Program:     int(ms.pc),
+			Instrument:  instrument,
+			Volume:      int(ms.volume),
+			Expression:  int(ms.expression),
+			Pan:         int(ms.pan),
+			Modulation:  int(ms.modulation),
+			Reverb:      int(ms.reverb),
+			Chorus:      int(ms.chorus),
+			PitchBend:   int(ms.pitch),
+			Sustain:     ms.sustain != 0,
+			Mono:        ms.mono,
+			Voices:      len(voices),
+			Notes:       notes,
+		}
+	}
+	return result
+}
 
+func (ctrl *Controller) printStatus() {
+	var b strings.Builder
+	b.WriteString("\nCh MSB-LSB-@PC Instrument       P Vol Exp Pan Vo Note\n")
+	for i, snapshot := range ctrl.midiChannelSnapshots() {
+		ms := ctrl.midiChannelStates[i]
 		monopoly := "-"
 		note := ""
-		instr := ms.debugLastInstrument
+		name := ""
 		pc := "-----------"
-		if instr == nil || instr == smaf.DefaultPC {
-			instr = &smaf.VM35VoicePC{}
-		} else {
-			if ms.mono {
+		if instr := ms.debugLastInstrument; instr != nil && instr != smaf.DefaultPC {
+			if snapshot.Mono {
 				monopoly = "M"
 			} else {
 				monopoly = "P"
 			}
-			pc = fmt.Sprintf("%03d-%03d-%03d", ms.bankMSB, ms.bankLSB, ms.pc)
-			note = fmt.Sprintf("%s%d", notes[cs.note%12], cs.note/12-2)
-		}
-		if voices == 0 {
-			note = ""
+			name = snapshot.Instrument
+			pc = fmt.Sprintf("%03d-%03d-%03d", snapshot.BankMSB, snapshot.BankLSB, snapshot.Program)
+			if 0 < snapshot.Voices {
+				n := snapshot.Notes[snapshot.Voices-1]
+				note = fmt.Sprintf("%s%d", notes[n%12], n/12-2)
+			}
 		}
-		fmt.Printf(
+		fmt.Fprintf(
+			&b,
 			"%2d %s %-16s %s %3d %3d %3d %2d %-4s\n",
 			i+1,
 			pc,
-			instr.Name,
+			name,
 			monopoly,
-			ms.volume,
-			ms.expression,
-			ms.pan,
-			voices,
+			snapshot.Volume,
+			snapshot.Expression,
+			snapshot.Pan,
+			snapshot.Voices,
 			note,
 		)
 	}
+	ctrl.logger.Printf("%s", b.String())
 }
 
 // noteOn は、MIDIノートオン受信時の音源の振る舞いを再現します。
@@ -295,13 +475,17 @@ func (ctrl *Controller) noteOn(midich, note, velocity int) {
 
 	instr, ok := ctrl.getInstrument(midich, note)
 	if !ok {
-		// TODO: warning or ignore by option
-		// return
-		_ = ok
+		ctrl.notify(&Event{Type: EventProgramNotFound}, midich, note, -1)
 	}
 
 	if instr.VoiceType != smaf.VoiceType_FM {
-		fmt.Printf("unsupported voice type: @%d-%d-%d note=%d type=%s\n", instr.BankMsb, instr.BankLsb, instr.Pc, note, instr.VoiceType)
+		ctrl.notify(&Event{
+			Type:      EventUnsupportedVoiceType,
+			BankMSB:   int(instr.BankMsb),
+			BankLSB:   int(instr.BankLsb),
+			Program:   int(instr.Pc),
+			VoiceType: instr.VoiceType,
+		}, midich, note, -1)
 		return
 	}
 
@@ -314,11 +498,25 @@ func (ctrl *Controller) noteOn(midich, note, velocity int) {
 	}
 	if 0 <= chipch {
 		ctrl.occupyChipChannel(chipch, midich, note, velocity, instr)
+		ctrl.notify(&Event{Type: EventNoteAssigned}, midich, note, chipch)
 	} else {
-		fmt.Printf("no free chip channel for MIDI channel #%d\n", midich)
+		ctrl.notify(&Event{Type: EventNoteDropped}, midich, note, -1)
 	}
 }
 
+// notify は、イベントに発生元のノートの情報を付加して Observer に通知します。
+// EventUnsupportedVoiceType 以外では、MIDIチャンネルで選択されている音色の情報も付加します。
+func (ctrl *Controller) notify(ev *Event, midich, note, chipch int) {
+	ev.MIDIChannel = midich
+	ev.Note = note
+	ev.ChipChannel = chipch
+	if ev.Type != EventUnsupportedVoiceType {
+		s := ctrl.midiChannelStates[midich]
+		ev.BankMSB, ev.BankLSB, ev.Program = int(s.bankMSB), int(s.bankLSB), int(s.pc)
+	}
+	ctrl.observer.Observe(ev)
+}
+
 // noteOff は、MIDIノートオフ受信時の音源の振る舞いを再現します。
 func (ctrl *Controller) noteOff(midich, note int) {
 	if _, ok := ctrl.ignoreMIDIChannels[midich]; ok {
@@ -382,6 +580,14 @@ func (ctrl *Controller) controlChange(midich, cc, value int) {
 		channel.pan = uint8(value)
 		ctrl.writeChannelsUsingMIDIChannel(midich, ymf.CHPAN, value)
 
+	case ccReverb: // change reverb send level
+		channel.reverb = uint8(value)
+		ctrl.writeChannelsUsingMIDIChannel(midich, ymf.REVERB, value)
+
+	case ccChorus: // change chorus send level
+		channel.chorus = uint8(value)
+		ctrl.writeChannelsUsingMIDIChannel(midich, ymf.CHORUS, value)
+
 	case ccSustainPedal: // change sustain pedal (hold)
 		channel.sustain = uint8(value)
 		if value < 0x40 {
@@ -509,6 +715,8 @@ func (ctrl *Controller) occupyChipChannel(chipch, midich, note, velocity int, in
 	ctrl.writeInstrument(chipch, instr)
 	ctrl.writeModulation(chipch, instr, chipState.flags&flagVibrato != 0)
 	ctrl.registers.WriteChannel(chipch, ymf.CHPAN, int(ctrl.midiChannelStates[midich].pan))
+	ctrl.registers.WriteChannel(chipch, ymf.REVERB, int(ctrl.midiChannelStates[midich].reverb))
+	ctrl.registers.WriteChannel(chipch, ymf.CHORUS, int(ctrl.midiChannelStates[midich].chorus))
 	if ctrl.soloMIDIChannel < 0 || midich == ctrl.soloMIDIChannel {
 		ctrl.registers.WriteChannel(chipch, ymf.VOLUME, int(ctrl.midiChannelStates[midich].volume))
 	} else {
@@ -549,7 +757,7 @@ func (ctrl *Controller) findLastUsedChipChannel(midich, note int) int {
 	found := -1
 	minDelta := math.MaxInt64
 	for i, state := range ctrl.chipChannelStates {
-		if state.midiChannel != midich {
+		if state.midiChannel != midich || !ctrl.isAvailableChipChannel(midich, i) {
 			continue
 		}
 		if state.note == note {
@@ -579,7 +787,7 @@ func (ctrl *Controller) findFreeChipChannel(midich, note int) int {
 
 	// 無音のチャンネルがあれば選択
 	for i, state := range ctrl.chipChannelStates {
-		if state.flags&flagFree != 0 {
+		if state.flags&flagFree != 0 && ctrl.isAvailableChipChannel(midich, i) {
 			return i
 		}
 	}
@@ -590,6 +798,9 @@ func (ctrl *Controller) findFreeChipChannel(midich, note int) int {
 	maxDeltaTotal := -1
 	maxAttenuationReleased := -1
 	for i, state := range ctrl.chipChannelStates {
+		if !ctrl.isAvailableChipChannel(midich, i) {
+			continue
+		}
 		delta := int(now.Sub(state.time))
 		if maxDeltaTotal < delta {
 			maxDeltaTotal = delta
@@ -605,12 +816,12 @@ func (ctrl *Controller) findFreeChipChannel(midich, note int) int {
 
 	// リリース後に最も減衰していると思われるチャンネルを選択
 	if 0 <= foundReleased {
-		ctrl.resetChipChannel(foundReleased)
+		ctrl.stealChipChannel(foundReleased, midich, note)
 		return foundReleased
 	}
 	// 未リリースだが最も古くなったと思われるチャンネルを選択
 	if 0 <= foundTotal {
-		ctrl.resetChipChannel(foundTotal)
+		ctrl.stealChipChannel(foundTotal, midich, note)
 		return foundTotal
 	}
 
@@ -618,6 +829,25 @@ func (ctrl *Controller) findFreeChipChannel(midich, note int) int {
 	return -1
 }
 
+// stealChipChannel は、発音中のチャンネルを新たなノートのためにリセットし、Observer に通知します。
+func (ctrl *Controller) stealChipChannel(chipch, midich, note int) {
+	state := ctrl.chipChannelStates[chipch]
+	ev := &Event{
+		Type:              EventVoiceStolen,
+		StolenMIDIChannel: state.midiChannel,
+		StolenNote:        state.note,
+		StolenReleased:    state.flags&flagReleased != 0,
+	}
+	ctrl.resetChipChannel(chipch)
+	ctrl.notify(ev, midich, note, chipch)
+}
+
+// isAvailableChipChannel は、指定MIDIチャンネルの発音に指定チャンネルを使用できるかどうかを返します。
+func (ctrl *Controller) isAvailableChipChannel(midich, chipch int) bool {
+	chip, ok := ctrl.chipAffinity[midich]
+	return !ok || ctrl.chipChannelStates[chipch].chip == chip
+}
+
 func (ctrl *Controller) getInstrument(midich, note int) (*smaf.VM35VoicePC, bool) {
 	s := ctrl.midiChannelStates[midich]
 	result, ok := ctrl.library.Get(int(s.bankMSB), int(s.bankLSB), int(s.pc), note)
@@ -631,6 +861,8 @@ func (ctrl *Controller) resetMIDIChannel(midich int) {
 	ctrl.midiChannelStates[midich].volume = 100
 	ctrl.midiChannelStates[midich].expression = 127
 	ctrl.midiChannelStates[midich].pan = 64
+	ctrl.midiChannelStates[midich].reverb = 40
+	ctrl.midiChannelStates[midich].chorus = 0
 	ctrl.midiChannelStates[midich].sustain = 0
 	ctrl.midiChannelStates[midich].pitch = 64
 	ctrl.midiChannelStates[midich].rpn = 0x3fff
@@ -0,0 +1,208 @@
+package fmfm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/but80/fmfm.core/internal/binstate"
+	"gopkg.in/but80/go-smaf.v1/pb/smaf"
+)
+
+const (
+	controllerStateMagic   = "fmfm.controller"
+	controllerStateVersion = 3
+)
+
+const (
+	instrumentNone      = -1
+	instrumentDefault   = -2
+	instrumentSMAFEmpty = -3
+)
+
+// SaveState は、MIDIチャンネルの状態、音源チャンネルの割り当て、未処理のMIDIメッセージを含む
+// コントローラの状態をバイト列に直列化します。
+// 音色は音色ライブラリ内の位置として記録されるため、復元時には同じ音色ライブラリを使用する必要があります。
+// 音源チップ自体の状態は含まれないため、sim.Chip の SaveState と併せて使用します。
+func (ctrl *Controller) SaveState() ([]byte, error) {
+	ctrl.mutex.Lock()
+	defer ctrl.mutex.Unlock()
+
+	ctrl.receiveMIDIMessages()
+	w := binstate.NewWriter(controllerStateMagic, controllerStateVersion)
+	w.Int(len(ctrl.chipChannelStates))
+	w.Int(len(ctrl.midiChannelStates))
+	for _, s := range ctrl.midiChannelStates {
+		w.Int(int(s.bankLSB))
+		w.Int(int(s.bankMSB))
+		w.Int(int(s.pc))
+		w.Int(int(s.volume))
+		w.Int(int(s.expression))
+		w.Int(int(s.pan))
+		w.Int(int(s.reverb))
+		w.Int(int(s.chorus))
+		w.Int(int(s.pitch))
+		w.Int(int(s.sustain))
+		w.Int(int(s.modulation))
+		w.Int(int(s.pitchSens))
+		w.Int(int(s.rpn))
+		w.Bool(s.mono)
+		if err := ctrl.writeInstrumentRef(w, s.debugLastInstrument); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range ctrl.chipChannelStates {
+		w.Int(s.midiChannel)
+		w.Int(s.note)
+		w.Int(s.realnote)
+		w.Int(int(s.flags))
+		w.Int(s.finetune)
+		w.Int(s.pitch)
+		if err := ctrl.writeInstrumentRef(w, s.instrument); err != nil {
+			return nil, err
+		}
+		w.Int(int(s.time.UnixNano()))
+		w.Int(s.minRR)
+	}
+	w.Int(len(ctrl.midiMessages))
+	for _, msg := range ctrl.midiMessages {
+		w.Int(int(msg.typ))
+		w.Int(msg.timestamp)
+		w.Int(msg.midiChannel)
+		w.Int(msg.data1)
+		w.Int(msg.data2)
+	}
+	return w.Bytes(), nil
+}
+
+// LoadState は、SaveState で直列化された状態を復元します。
+// レジスタへの書き込みは行わないため、音源チップの状態は別途復元する必要があります。
+func (ctrl *Controller) LoadState(data []byte) error {
+	ctrl.mutex.Lock()
+	defer ctrl.mutex.Unlock()
+
+	r, err := binstate.NewReader(data, controllerStateMagic, controllerStateVersion)
+	if err != nil {
+		return err
+	}
+	chipChannels := r.Int()
+	midiChannels := r.Int()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if chipChannels != len(ctrl.chipChannelStates) || midiChannels != len(ctrl.midiChannelStates) {
+		return fmt.Errorf(
+			"controller configuration mismatch: state has %d chip channels and %d MIDI channels",
+			chipChannels, midiChannels,
+		)
+	}
+
+	midiChannelStates := make([]midiChannelState, len(ctrl.midiChannelStates))
+	for i := range midiChannelStates {
+		s := &midiChannelStates[i]
+		s.bankLSB = uint8(r.Int())
+		s.bankMSB = uint8(r.Int())
+		s.pc = uint8(r.Int())
+		s.volume = uint8(r.Int())
+		s.expression = uint8(r.Int())
+		s.pan = uint8(r.Int())
+		s.reverb = uint8(r.Int())
+		s.chorus = uint8(r.Int())
+		s.pitch = int8(r.Int())
+		s.sustain = uint8(r.Int())
+		s.modulation = uint8(r.Int())
+		s.pitchSens = uint16(r.Int())
+		s.rpn = uint16(r.Int())
+		s.mono = r.Bool()
+		s.debugLastInstrument = ctrl.readInstrumentRef(r)
+	}
+	chipChannelStates := make([]chipChannelState, len(ctrl.chipChannelStates))
+	for i := range chipChannelStates {
+		s := &chipChannelStates[i]
+		s.chip = ctrl.chipChannelStates[i].chip
+		s.midiChannel = r.Int()
+		s.note = r.Int()
+		s.realnote = r.Int()
+		s.flags = flag(r.Int())
+		s.finetune = r.Int()
+		s.pitch = r.Int()
+		s.instrument = ctrl.readInstrumentRef(r)
+		s.time = time.Unix(0, int64(r.Int()))
+		s.minRR = r.Int()
+	}
+	n := r.Int()
+	if r.Err() == nil && (n < 0 || len(data) < n) {
+		r.Fail(fmt.Errorf("invalid number of pending MIDI messages: %d", n))
+	}
+	var midiMessages []*midiMessage
+	for i := 0; i < n && r.Err() == nil; i++ {
+		midiMessages = append(midiMessages, &midiMessage{
+			typ:         MIDIMessage(r.Int()),
+			timestamp:   r.Int(),
+			midiChannel: r.Int(),
+			data1:       r.Int(),
+			data2:       r.Int(),
+		})
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	for i := range midiChannelStates {
+		*ctrl.midiChannelStates[i] = midiChannelStates[i]
+	}
+	for i := range chipChannelStates {
+		*ctrl.chipChannelStates[i] = chipChannelStates[i]
+	}
+	// 復元前に追加されたメッセージは破棄する
+	ctrl.receiveMIDIMessages()
+	ctrl.midiMessages = midiMessages
+	return nil
+}
+
+// writeInstrumentRef は、音色を音色ライブラリ内の位置として書き込みます。
+func (ctrl *Controller) writeInstrumentRef(w *binstate.Writer, instr *smaf.VM35VoicePC) error {
+	switch instr {
+	case nil:
+		w.Int(instrumentNone)
+		return nil
+	case defaultPC:
+		w.Int(instrumentDefault)
+		return nil
+	case smaf.DefaultPC:
+		w.Int(instrumentSMAFEmpty)
+		return nil
+	}
+	for i, pc := range ctrl.programs() {
+		if pc == instr {
+			w.Int(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("instrument not found in library: @%d-%d-%d", instr.BankMsb, instr.BankLsb, instr.Pc)
+}
+
+// readInstrumentRef は、writeInstrumentRef で書き込まれた音色を読み出します。
+func (ctrl *Controller) readInstrumentRef(r *binstate.Reader) *smaf.VM35VoicePC {
+	i := r.Int()
+	switch {
+	case r.Err() != nil:
+		return nil
+	case i == instrumentNone:
+		return nil
+	case i == instrumentDefault:
+		return defaultPC
+	case i == instrumentSMAFEmpty:
+		return smaf.DefaultPC
+	case 0 <= i && i < len(ctrl.programs()):
+		return ctrl.programs()[i]
+	}
+	r.Fail(fmt.Errorf("instrument index out of library: %d", i))
+	return nil
+}
+
+func (ctrl *Controller) programs() []*smaf.VM35VoicePC {
+	if ctrl.library == nil {
+		return nil
+	}
+	return ctrl.library.Programs
+}
@@ -1,6 +1,7 @@
 package fmfm
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/but80/fmfm.core/ymf"
@@ -9,13 +10,14 @@ import (
 )
 
 type registers struct {
+	channelCount int
 	channels     [ymfdata.ChannelCount]map[ymf.ChRegister]int
 	operators    [ymfdata.ChannelCount][4]map[ymf.OpRegister]int
 	midiChannels [ymfdata.ChannelCount]int
 }
 
 func newRegisters() *registers {
-	result := &registers{}
+	result := &registers{channelCount: ymfdata.ChannelCount}
 	for i := 0; i < ymfdata.ChannelCount; i++ {
 		m := map[ymf.ChRegister]int{}
 		m[ymf.PANPOT] = 15
@@ -65,6 +67,11 @@ func (regs *registers) DebugSetMIDIChannel(channel, midiChannel int) {
 	regs.midiChannels[channel] = midiChannel
 }
 
+// ChannelCount は、音源チップが備えるチャンネル数を返します。
+func (regs *registers) ChannelCount() int {
+	return regs.channelCount
+}
+
 func TestController_writeFrequency(t *testing.T) {
 	regs := newRegisters()
 	ctrl := NewController(&ControllerOpts{Registers: regs})
@@ -85,3 +92,200 @@ func TestController_writeFrequency(t *testing.T) {
 		ctrl.resetChipChannel(0)
 	}
 }
+
+func TestController_channelCount(t *testing.T) {
+	regs := newRegisters()
+	regs.channelCount = 16
+	ctrl := NewController(&ControllerOpts{Registers: regs})
+	assert.Equal(t, 16, len(ctrl.chipChannelStates))
+	for i := 0; i < 16; i++ {
+		ctrl.noteOn(0, 48+i, 127)
+	}
+	for i, state := range ctrl.chipChannelStates {
+		assert.Equal(t, 48+i, state.note)
+	}
+	// 17音目は最も古いチャンネルを奪う
+	ctrl.noteOn(0, 64, 127)
+	assert.Equal(t, 64, ctrl.chipChannelStates[0].note)
+	for _, ch := range regs.channels[16:] {
+		assert.Equal(t, 0, ch[ymf.KON])
+	}
+}
+
+func TestController_chipAffinity(t *testing.T) {
+	chips := []*registers{newRegisters(), newRegisters()}
+	for _, regs := range chips {
+		regs.channelCount = 16
+	}
+	ctrl := NewController(&ControllerOpts{
+		Registers:    ymf.NewMultiRegisters(chips[0], chips[1]),
+		ChipAffinity: map[int]int{1: 1},
+	})
+	assert.Equal(t, 32, len(ctrl.chipChannelStates))
+
+	// アフィニティのないMIDIチャンネルは両チップを1つのプールとして使用する
+	for i := 0; i < 20; i++ {
+		ctrl.noteOn(0, 40+i, 127)
+	}
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, 0, ctrl.chipChannelStates[i].midiChannel)
+	}
+	assert.Equal(t, 1, chips[1].channels[3][ymf.KON])
+	assert.Equal(t, 0, chips[1].midiChannels[3])
+	assert.Equal(t, 0, chips[1].channels[4][ymf.KON])
+	assert.Equal(t, -1, chips[1].midiChannels[4])
+
+	// アフィニティのあるMIDIチャンネルは指定チップのチャンネルのみ使用する
+	ctrl.noteOn(1, 60, 127)
+	assert.Equal(t, 1, ctrl.chipChannelStates[20].midiChannel)
+	assert.Equal(t, 1, chips[1].channels[4][ymf.KON])
+	assert.Equal(t, 1, chips[1].midiChannels[4])
+	assert.Equal(t, 60, ctrl.chipChannelStates[20].note)
+
+	// チップ1のチャンネルがすべて使用中の場合、チップ0に空きがあっても奪う
+	for i := 0; i < 11; i++ {
+		ctrl.noteOn(1, 61+i, 127)
+	}
+	ctrl.noteOn(1, 80, 127)
+	for i, state := range ctrl.chipChannelStates[:16] {
+		assert.Equal(t, 0, state.midiChannel, "chip 0 channel %d", i)
+	}
+}
+
+func TestController_invalidChipAffinity(t *testing.T) {
+	chips := []*registers{newRegisters(), newRegisters()}
+	for _, regs := range chips {
+		regs.channelCount = 16
+	}
+	events := []*Event{}
+	ctrl := NewController(&ControllerOpts{
+		Registers:    ymf.NewMultiRegisters(chips[0], chips[1]),
+		ChipAffinity: map[int]int{2: 5, 1: 1},
+		Observer: ObserverFunc(func(ev *Event) {
+			events = append(events, ev)
+		}),
+	})
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, EventInvalidChipAffinity, events[0].Type)
+	assert.Equal(t, 2, events[0].MIDIChannel)
+	assert.Equal(t, 5, events[0].Chip)
+
+	// 存在しないチップを指定したMIDIチャンネルは全チップのチャンネルを使用する
+	ctrl.noteOn(2, 60, 127)
+	assert.Equal(t, 1, chips[0].channels[0][ymf.KON])
+	assert.Equal(t, 2, chips[0].midiChannels[0])
+}
+
+func TestController_MIDIChannelSnapshots(t *testing.T) {
+	regs := newRegisters()
+	ctrl := NewController(&ControllerOpts{Registers: regs})
+	ctrl.controlChange(2, ccVolume, 90)
+	ctrl.noteOn(2, 60, 100)
+	ctrl.noteOn(2, 64, 100)
+	ctrl.noteOn(5, 67, 100)
+	ctrl.noteOff(5, 67)
+
+	snapshots := ctrl.MIDIChannelSnapshots()
+	assert.Len(t, snapshots, 16)
+	s := snapshots[2]
+	assert.Equal(t, 2, s.MIDIChannel)
+	assert.Equal(t, 90, s.Volume)
+	assert.Equal(t, "default", s.Instrument)
+	assert.Equal(t, 2, s.Voices)
+	assert.Len(t, s.Notes, 2)
+	assert.Equal(t, 0, snapshots[0].Voices)
+	assert.Equal(t, 1, snapshots[5].Voices)
+}
+
+func TestController_MIDIChannels(t *testing.T) {
+	regs := newRegisters()
+	ctrl := NewController(&ControllerOpts{Registers: regs, MIDIChannels: 32})
+	assert.Equal(t, 32, ctrl.MIDIChannelCount())
+	ctrl.PushMIDIMessage(MIDINoteOn, 0, 20, 60, 100)
+	ctrl.PushMIDIMessage(MIDINoteOn, 0, 40, 62, 100)
+	ctrl.ScheduleBlock(1, func(i int) int { return i }, func(from, to int) {})
+
+	snapshots := ctrl.MIDIChannelSnapshots()
+	assert.Len(t, snapshots, 32)
+	assert.Equal(t, 1, snapshots[20].Voices)
+	assert.Equal(t, 20, regs.midiChannels[0])
+}
+
+func TestController_observer(t *testing.T) {
+	regs := newRegisters()
+	regs.channelCount = 2
+	events := []Event{}
+	ctrl := NewController(&ControllerOpts{
+		Registers: regs,
+		Observer: ObserverFunc(func(ev *Event) {
+			events = append(events, *ev)
+		}),
+	})
+	ctrl.noteOn(0, 60, 100)
+	ctrl.noteOn(0, 62, 100)
+	ctrl.noteOn(1, 64, 100)
+
+	types := []EventType{}
+	for _, ev := range events {
+		if ev.Type != EventProgramNotFound {
+			types = append(types, ev.Type)
+		}
+	}
+	assert.Equal(t, []EventType{EventNoteAssigned, EventNoteAssigned, EventVoiceStolen, EventNoteAssigned}, types)
+	ev := events[len(events)-2]
+	assert.Equal(t, 1, ev.MIDIChannel)
+	assert.Equal(t, 64, ev.Note)
+	assert.Equal(t, 0, ev.StolenMIDIChannel)
+	assert.Equal(t, 60, ev.StolenNote)
+	assert.False(t, ev.StolenReleased)
+
+	regs.channelCount = 0
+	ctrl = NewController(&ControllerOpts{
+		Registers: regs,
+		Observer: ObserverFunc(func(ev *Event) {
+			events = append(events, *ev)
+		}),
+	})
+	events = events[:0]
+	ctrl.noteOn(0, 60, 100)
+	assert.Equal(t, EventNoteDropped, events[len(events)-1].Type)
+}
+
+type testLogger []string
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func TestController_logger(t *testing.T) {
+	regs := newRegisters()
+	regs.channelCount = 0
+	logger := &testLogger{}
+	ctrl := NewController(&ControllerOpts{
+		Registers: regs,
+		Logger:    logger,
+	})
+	ctrl.noteOn(0, 60, 100)
+	assert.Equal(t, []string{"no free chip channel for MIDI channel #0"}, []string(*logger))
+}
+
+func TestController_ScheduleBlock(t *testing.T) {
+	regs := newRegisters()
+	ctrl := NewController(&ControllerOpts{Registers: regs, Observer: ObserverFunc(func(ev *Event) {})})
+	ctrl.PushMIDIMessage(MIDINoteOn, 7, 0, 64, 100)
+	ctrl.PushMIDIMessage(MIDINoteOn, 3, 0, 60, 100)
+	ctrl.PushMIDIMessage(MIDINoteOn, 3, 0, 62, 100)
+	ctrl.PushMIDIMessage(MIDINoteOn, 20, 0, 65, 100)
+
+	segments := [][2]int{}
+	voices := []int{}
+	ctrl.ScheduleBlock(10, func(i int) int {
+		return i
+	}, func(from, to int) {
+		segments = append(segments, [2]int{from, to})
+		voices = append(voices, ctrl.midiChannelSnapshots()[0].Voices)
+	})
+	assert.Equal(t, [][2]int{{0, 3}, {3, 7}, {7, 10}}, segments)
+	assert.Equal(t, []int{0, 2, 3}, voices)
+	assert.Len(t, ctrl.midiMessages, 1)
+}
@@ -0,0 +1,97 @@
+// Package effect は、音源の出力に適用するエフェクトを提供します。
+// 各エフェクトは、1サンプルずつ左右の振幅を処理する Next メソッドを備えます。
+package effect
+
+import (
+	"math"
+)
+
+// ButterworthQ は、2次のバターワース特性となる Q です。
+const ButterworthQ = math.Sqrt2 / 2.0
+
+// Biquad は、左右それぞれの信号に適用する2次の IIR フィルタです。
+// 係数は RBJ Audio EQ Cookbook に基づいて算出します。
+type Biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     [2]float64
+}
+
+// NewBiquad は、入力をそのまま出力する新しい Biquad を作成します。
+func NewBiquad() *Biquad {
+	return &Biquad{b0: 1.0}
+}
+
+// setCoefs は、a0 で正規化した係数を設定します。
+func (f *Biquad) setCoefs(b0, b1, b2, a0, a1, a2 float64) *Biquad {
+	f.b0, f.b1, f.b2 = b0/a0, b1/a0, b2/a0
+	f.a1, f.a2 = a1/a0, a2/a0
+	return f
+}
+
+// omega は、周波数 freq [Hz] に対応する角周波数の余弦と、Q に応じた alpha を返します。
+func omega(sampleRate, freq, q float64) (float64, float64) {
+	w := 2.0 * math.Pi * math.Min(freq, sampleRate*.49) / sampleRate
+	return math.Cos(w), math.Sin(w) / (2.0 * q)
+}
+
+// SetLowPass は、遮断周波数 freq [Hz] のローパスフィルタに設定します。
+func (f *Biquad) SetLowPass(sampleRate, freq, q float64) *Biquad {
+	cos, alpha := omega(sampleRate, freq, q)
+	return f.setCoefs((1.0-cos)*.5, 1.0-cos, (1.0-cos)*.5, 1.0+alpha, -2.0*cos, 1.0-alpha)
+}
+
+// SetHighPass は、遮断周波数 freq [Hz] のハイパスフィルタに設定します。
+func (f *Biquad) SetHighPass(sampleRate, freq, q float64) *Biquad {
+	cos, alpha := omega(sampleRate, freq, q)
+	return f.setCoefs((1.0+cos)*.5, -(1.0 + cos), (1.0+cos)*.5, 1.0+alpha, -2.0*cos, 1.0-alpha)
+}
+
+// SetPeaking は、中心周波数 freq [Hz] を gain [dB] だけ増減するピーキングフィルタに設定します。
+func (f *Biquad) SetPeaking(sampleRate, freq, gain, q float64) *Biquad {
+	cos, alpha := omega(sampleRate, freq, q)
+	a := math.Pow(10, gain/40.0)
+	return f.setCoefs(1.0+alpha*a, -2.0*cos, 1.0-alpha*a, 1.0+alpha/a, -2.0*cos, 1.0-alpha/a)
+}
+
+// SetLowShelf は、周波数 freq [Hz] 以下を gain [dB] だけ増減するシェルビングフィルタに設定します。
+func (f *Biquad) SetLowShelf(sampleRate, freq, gain, q float64) *Biquad {
+	cos, alpha := omega(sampleRate, freq, q)
+	a := math.Pow(10, gain/40.0)
+	s := 2.0 * math.Sqrt(a) * alpha
+	return f.setCoefs(
+		a*((a+1.0)-(a-1.0)*cos+s),
+		2.0*a*((a-1.0)-(a+1.0)*cos),
+		a*((a+1.0)-(a-1.0)*cos-s),
+		(a+1.0)+(a-1.0)*cos+s,
+		-2.0*((a-1.0)+(a+1.0)*cos),
+		(a+1.0)+(a-1.0)*cos-s,
+	)
+}
+
+// SetHighShelf は、周波数 freq [Hz] 以上を gain [dB] だけ増減するシェルビングフィルタに設定します。
+func (f *Biquad) SetHighShelf(sampleRate, freq, gain, q float64) *Biquad {
+	cos, alpha := omega(sampleRate, freq, q)
+	a := math.Pow(10, gain/40.0)
+	s := 2.0 * math.Sqrt(a) * alpha
+	return f.setCoefs(
+		a*((a+1.0)+(a-1.0)*cos+s),
+		-2.0*a*((a-1.0)+(a+1.0)*cos),
+		a*((a+1.0)+(a-1.0)*cos-s),
+		(a+1.0)-(a-1.0)*cos+s,
+		2.0*((a-1.0)-(a+1.0)*cos),
+		(a+1.0)-(a-1.0)*cos-s,
+	)
+}
+
+// Process は、チャンネル ch (0: 左, 1: 右) の次の入力 x に対する出力を返します。
+func (f *Biquad) Process(ch int, x float64) float64 {
+	y := f.b0*x + f.b1*f.x1[ch] + f.b2*f.x2[ch] - f.a1*f.y1[ch] - f.a2*f.y2[ch]
+	f.x2[ch], f.x1[ch] = f.x1[ch], x
+	f.y2[ch], f.y1[ch] = f.y1[ch], y
+	return y
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (f *Biquad) Next(l, r float64) (float64, float64) {
+	return f.Process(0, l), f.Process(1, r)
+}
@@ -0,0 +1,201 @@
+package effect
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// crossover は、信号を遮断周波数の上下の帯域に分ける4次の Linkwitz-Riley フィルタです。
+// 分けた帯域を加算すると、振幅特性が平坦なオールパスフィルタとなります。
+type crossover struct {
+	lowPass, highPass [2]Biquad
+}
+
+func newCrossover(sampleRate, freq float64) *crossover {
+	c := &crossover{}
+	for i := range c.lowPass {
+		c.lowPass[i].SetLowPass(sampleRate, freq, ButterworthQ)
+		c.highPass[i].SetHighPass(sampleRate, freq, ButterworthQ)
+	}
+	return c
+}
+
+// split は、チャンネル ch の入力 x を、遮断周波数の下の帯域と上の帯域に分けます。
+func (c *crossover) split(ch int, x float64) (float64, float64) {
+	low, high := x, x
+	for i := range c.lowPass {
+		low = c.lowPass[i].Process(ch, low)
+		high = c.highPass[i].Process(ch, high)
+	}
+	return low, high
+}
+
+// compressorBand は、Compressor の1つの帯域です。
+type compressorBand struct {
+	// crossover は、この帯域とより高い帯域とを分けるフィルタです。最も高い帯域では nil です。
+	crossover *crossover
+	// allpasses は、より高い帯域を分けるフィルタと位相を揃えるためのオールパスフィルタです。
+	allpasses []*crossover
+	// reduction は、現在の減衰量 [dB] です。
+	reduction float64
+}
+
+// Compressor は、インサーションエフェクト「コンプレッサー」です。
+// 左右の大きい方の振幅がスレッショルドレベルを超えた分を、レシオに応じて圧縮します。
+// クロスオーバー周波数を指定した場合は、帯域ごとに独立して圧縮するマルチバンドコンプレッサーとして動作します。
+type Compressor struct {
+	sampleRate  float64
+	thresholdDB float64
+	ratio       float64
+	attack      float64
+	release     float64
+	makeupDB    float64
+	bands       []*compressorBand
+}
+
+// NewCompressor は、新しい Compressor を作成します。
+// crossovers は、帯域を分けるクロスオーバー周波数 [Hz] です。省略した場合は全帯域をまとめて圧縮します。
+func NewCompressor(sampleRate float64, crossovers ...float64) *Compressor {
+	comp := &Compressor{
+		sampleRate: sampleRate,
+	}
+	freqs := append([]float64{}, crossovers...)
+	sort.Float64s(freqs)
+	for i := 0; i <= len(freqs); i++ {
+		band := &compressorBand{}
+		if i < len(freqs) {
+			band.crossover = newCrossover(sampleRate, freqs[i])
+			for _, f := range freqs[i+1:] {
+				band.allpasses = append(band.allpasses, newCrossover(sampleRate, f))
+			}
+		}
+		comp.bands = append(comp.bands, band)
+	}
+	return comp.SetThreshold(-18.0).SetRatio(4.0).SetAttack(.005).SetRelease(.1).SetMakeup(.0)
+}
+
+// ParseCompressor は、"<スレッショルド>:<レシオ>[:<アタック>[:<リリース>[:<メイクアップ>]]][@<クロスオーバー周波数>,...]"
+// 形式の文字列から、新しい Compressor を作成します。
+// スレッショルドとメイクアップゲインは dB、アタックタイムとリリースタイムはミリ秒で指定します。
+// 例えば "-20:3:10:200@200,2000" は、200Hz と 2kHz で分けた3つの帯域をそれぞれ圧縮します。
+func ParseCompressor(sampleRate float64, spec string) (*Compressor, error) {
+	var crossovers []float64
+	if i := strings.Index(spec, "@"); 0 <= i {
+		for _, s := range strings.Split(spec[i+1:], ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil || f <= 0 {
+				return nil, fmt.Errorf("invalid crossover frequency: %s", s)
+			}
+			crossovers = append(crossovers, f)
+		}
+		spec = spec[:i]
+	}
+	fields := strings.Split(spec, ":")
+	if len(fields) < 2 || 5 < len(fields) {
+		return nil, fmt.Errorf("invalid compressor settings: %s", spec)
+	}
+	values := make([]float64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compressor settings: %s", spec)
+		}
+		values[i] = v
+	}
+	if values[1] < 1.0 {
+		return nil, fmt.Errorf("invalid compressor ratio: %g", values[1])
+	}
+	comp := NewCompressor(sampleRate, crossovers...).SetThreshold(values[0]).SetRatio(values[1])
+	if 3 <= len(values) {
+		comp.SetAttack(values[2] / 1000.0)
+	}
+	if 4 <= len(values) {
+		comp.SetRelease(values[3] / 1000.0)
+	}
+	if 5 <= len(values) {
+		comp.SetMakeup(values[4])
+	}
+	return comp, nil
+}
+
+// SetThreshold は、スレッショルドレベル [dB] を設定します。
+func (comp *Compressor) SetThreshold(v float64) *Compressor {
+	comp.thresholdDB = v
+	return comp
+}
+
+// SetRatio は、スレッショルドレベルを超えた分の圧縮比を設定します。1 の場合は圧縮しません。
+func (comp *Compressor) SetRatio(v float64) *Compressor {
+	comp.ratio = math.Max(1.0, v)
+	return comp
+}
+
+// SetAttack は、アタックタイム [秒] を設定します。
+func (comp *Compressor) SetAttack(sec float64) *Compressor {
+	comp.attack = comp.timeToMultiplier(sec)
+	return comp
+}
+
+// SetRelease は、リリースタイム [秒] を設定します。
+func (comp *Compressor) SetRelease(sec float64) *Compressor {
+	comp.release = comp.timeToMultiplier(sec)
+	return comp
+}
+
+// SetMakeup は、圧縮後にかけるメイクアップゲイン [dB] を設定します。
+func (comp *Compressor) SetMakeup(v float64) *Compressor {
+	comp.makeupDB = v
+	return comp
+}
+
+// BandCount は、帯域の数を返します。
+func (comp *Compressor) BandCount() int {
+	return len(comp.bands)
+}
+
+func (comp *Compressor) timeToMultiplier(sec float64) float64 {
+	if sec <= 0 {
+		return 0
+	}
+	return math.Exp(-1.0 / (sec * comp.sampleRate))
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (comp *Compressor) Next(l, r float64) (float64, float64) {
+	var outL, outR float64
+	for _, band := range comp.bands {
+		bandL, bandR := l, r
+		if band.crossover != nil {
+			bandL, l = band.crossover.split(0, l)
+			bandR, r = band.crossover.split(1, r)
+			for _, ap := range band.allpasses {
+				lowL, highL := ap.split(0, bandL)
+				lowR, highR := ap.split(1, bandR)
+				bandL, bandR = lowL+highL, lowR+highR
+			}
+		}
+		gain := comp.gain(band, math.Max(math.Abs(bandL), math.Abs(bandR)))
+		outL += bandL * gain
+		outR += bandR * gain
+	}
+	return outL, outR
+}
+
+// gain は、帯域の振幅 level に応じて減衰量を更新し、帯域にかける倍率を返します。
+func (comp *Compressor) gain(band *compressorBand, level float64) float64 {
+	target := .0
+	if 0 < level {
+		if over := 20.0*math.Log10(level) - comp.thresholdDB; 0 < over {
+			target = over * (1.0 - 1.0/comp.ratio)
+		}
+	}
+	k := comp.release
+	if band.reduction < target {
+		k = comp.attack
+	}
+	band.reduction = k*band.reduction + (1.0-k)*target
+	return math.Pow(10, (comp.makeupDB-band.reduction)/20.0)
+}
@@ -0,0 +1,34 @@
+package effect
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(t *testing.T) {
+	comp := NewCompressor(44100).SetThreshold(-20).SetRatio(4)
+	// 0dB の信号は、スレッショルドを超えた 20dB が 5dB に圧縮される
+	assert.InDelta(t, math.Pow(10, -15.0/20.0), sinePeak(comp.Next, 44100, 1000, 1), .02)
+	// スレッショルド以下の信号は圧縮されない
+	comp = NewCompressor(44100).SetThreshold(-20).SetRatio(4)
+	assert.InDelta(t, .05, sinePeak(comp.Next, 44100, 1000, .05), .001)
+}
+
+func TestCompressor_multiband(t *testing.T) {
+	// 圧縮しない場合、帯域を分けて加算しても振幅は変わらない
+	for _, hz := range []float64{50, 500, 5000} {
+		comp := NewCompressor(44100, 2000, 200).SetRatio(1)
+		assert.Equal(t, 3, comp.BandCount())
+		assert.InDelta(t, .5, sinePeak(comp.Next, 44100, hz, .5), .005, "%gHz", hz)
+	}
+
+	comp, err := ParseCompressor(44100, "-20:4:5:100:3@200,2000")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, comp.BandCount())
+	for _, spec := range []string{"-20", "-20:0.5", "-20:4@x", "a:4"} {
+		_, err = ParseCompressor(44100, spec)
+		assert.Error(t, err, spec)
+	}
+}
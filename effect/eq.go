@@ -0,0 +1,165 @@
+package effect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EQBandType は、イコライザの帯域のフィルタの種類を表す列挙子型です。
+type EQBandType int
+
+const (
+	// EQPeak は、中心周波数の付近を増減するピーキングフィルタを表す列挙子です。
+	EQPeak EQBandType = iota
+	// EQLowShelf は、周波数以下を増減するシェルビングフィルタを表す列挙子です。
+	EQLowShelf
+	// EQHighShelf は、周波数以上を増減するシェルビングフィルタを表す列挙子です。
+	EQHighShelf
+	// EQLowCut は、周波数以下を遮断するハイパスフィルタを表す列挙子です。
+	EQLowCut
+	// EQHighCut は、周波数以上を遮断するローパスフィルタを表す列挙子です。
+	EQHighCut
+)
+
+var eqBandTypeNames = []string{"peak", "lowshelf", "highshelf", "lowcut", "highcut"}
+
+func (t EQBandType) String() string {
+	if 0 <= int(t) && int(t) < len(eqBandTypeNames) {
+		return eqBandTypeNames[t]
+	}
+	return "?"
+}
+
+// EQBand は、イコライザの1つの帯域の設定です。
+type EQBand struct {
+	// Type は、フィルタの種類です。
+	Type EQBandType
+	// Frequency は、中心周波数または遮断周波数 [Hz] です。
+	Frequency float64
+	// Gain は、増減量 [dB] です。EQLowCut, EQHighCut では使用しません。
+	Gain float64
+	// Q は、帯域の鋭さです。0 の場合は ButterworthQ を使用します。
+	Q float64
+}
+
+// ParseEQBand は、"<種類>:<周波数>[:<増減量>[:<Q>]]" 形式の文字列を解析します。
+// 種類は EQBandType の String が返す名前で指定します。例えば "peak:1000:-3:2" は、
+// 1kHz を中心に Q=2 の幅で 3dB 減衰させる帯域です。
+func ParseEQBand(spec string) (EQBand, error) {
+	fields := strings.Split(spec, ":")
+	if len(fields) < 2 || 4 < len(fields) {
+		return EQBand{}, fmt.Errorf("invalid EQ band: %s", spec)
+	}
+	band := EQBand{Type: -1}
+	for i, name := range eqBandTypeNames {
+		if strings.EqualFold(fields[0], name) {
+			band.Type = EQBandType(i)
+		}
+	}
+	if band.Type < 0 {
+		return EQBand{}, fmt.Errorf("unknown EQ band type: %s", fields[0])
+	}
+	values := make([]float64, len(fields)-1)
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return EQBand{}, fmt.Errorf("invalid EQ band: %s", spec)
+		}
+		values[i] = v
+	}
+	band.Frequency = values[0]
+	if 2 <= len(values) {
+		band.Gain = values[1]
+	}
+	if 3 <= len(values) {
+		band.Q = values[2]
+	}
+	if band.Frequency <= 0 || band.Q < 0 {
+		return EQBand{}, fmt.Errorf("invalid EQ band: %s", spec)
+	}
+	return band, nil
+}
+
+// EQ は、複数の帯域を直列に適用するパラメトリックイコライザです。
+type EQ struct {
+	sampleRate float64
+	bands      []EQBand
+	filters    []*Biquad
+}
+
+// NewEQ は、帯域を持たない新しい EQ を作成します。
+func NewEQ(sampleRate float64) *EQ {
+	return &EQ{
+		sampleRate: sampleRate,
+		bands:      []EQBand{},
+		filters:    []*Biquad{},
+	}
+}
+
+// ParseEQ は、ParseEQBand 形式の帯域をカンマで区切って並べた文字列から、新しい EQ を作成します。
+// 空の文字列の場合は、帯域を持たない EQ を返します。
+func ParseEQ(sampleRate float64, spec string) (*EQ, error) {
+	eq := NewEQ(sampleRate)
+	if spec == "" {
+		return eq, nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		band, err := ParseEQBand(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		eq.AddBand(band)
+	}
+	return eq, nil
+}
+
+// AddBand は、帯域を追加します。
+func (eq *EQ) AddBand(band EQBand) *EQ {
+	f := NewBiquad()
+	eq.bands = append(eq.bands, band)
+	eq.filters = append(eq.filters, f)
+	eq.update(len(eq.bands) - 1)
+	return eq
+}
+
+// SetBand は、i 番目の帯域の設定を変更します。
+func (eq *EQ) SetBand(i int, band EQBand) *EQ {
+	eq.bands[i] = band
+	eq.update(i)
+	return eq
+}
+
+// Bands は、各帯域の設定を返します。
+func (eq *EQ) Bands() []EQBand {
+	return append([]EQBand{}, eq.bands...)
+}
+
+func (eq *EQ) update(i int) {
+	band := eq.bands[i]
+	q := band.Q
+	if q <= 0 {
+		q = ButterworthQ
+	}
+	f := eq.filters[i]
+	switch band.Type {
+	case EQPeak:
+		f.SetPeaking(eq.sampleRate, band.Frequency, band.Gain, q)
+	case EQLowShelf:
+		f.SetLowShelf(eq.sampleRate, band.Frequency, band.Gain, q)
+	case EQHighShelf:
+		f.SetHighShelf(eq.sampleRate, band.Frequency, band.Gain, q)
+	case EQLowCut:
+		f.SetHighPass(eq.sampleRate, band.Frequency, q)
+	case EQHighCut:
+		f.SetLowPass(eq.sampleRate, band.Frequency, q)
+	}
+}
+
+// Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
+func (eq *EQ) Next(l, r float64) (float64, float64) {
+	for _, f := range eq.filters {
+		l, r = f.Next(l, r)
+	}
+	return l, r
+}
@@ -0,0 +1,48 @@
+package effect
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sinePeak は、振幅 amp, 周波数 hz の正弦波を next に通し、定常状態での左の出力の最大振幅を返します。
+func sinePeak(next func(l, r float64) (float64, float64), sampleRate, hz, amp float64) float64 {
+	peak := .0
+	for i := 0; i < int(sampleRate); i++ {
+		v := amp * math.Sin(2.0*math.Pi*hz*float64(i)/sampleRate)
+		l, _ := next(v, v)
+		if sampleRate/2 <= float64(i) {
+			peak = math.Max(peak, math.Abs(l))
+		}
+	}
+	return peak
+}
+
+func TestParseEQBand(t *testing.T) {
+	band, err := ParseEQBand("peak:1000:-3:2")
+	assert.NoError(t, err)
+	assert.Equal(t, EQBand{Type: EQPeak, Frequency: 1000, Gain: -3, Q: 2}, band)
+
+	band, err = ParseEQBand("LowCut:80")
+	assert.NoError(t, err)
+	assert.Equal(t, EQBand{Type: EQLowCut, Frequency: 80}, band)
+
+	for _, spec := range []string{"peak", "notch:1000", "peak:0:3", "peak:1000:x", "peak:1:2:3:4"} {
+		_, err = ParseEQBand(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestEQ(t *testing.T) {
+	eq, err := ParseEQ(44100, "peak:1000:6:2, highcut:4000")
+	assert.NoError(t, err)
+	assert.Len(t, eq.Bands(), 2)
+	assert.InDelta(t, .2, sinePeak(eq.Next, 44100, 1000, .1), .005)
+	assert.True(t, sinePeak(eq.Next, 44100, 16000, .1) < .01)
+
+	eq, err = ParseEQ(44100, "")
+	assert.NoError(t, err)
+	assert.InDelta(t, .1, sinePeak(eq.Next, 44100, 1000, .1), 1e-5)
+}
@@ -0,0 +1,170 @@
+// Package binstate は、音源やコントローラの内部状態をバイト列に直列化するための補助的な型を提供します。
+package binstate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrShortState は、復元中にバイト列が途切れたことを表すエラーです。
+var ErrShortState = errors.New("binstate: unexpected end of state")
+
+// Writer は、値を順にリトルエンディアンのバイト列へ書き込みます。
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// NewWriter は、マジックナンバーとバージョンを書き込んだ新しい Writer を作成します。
+func NewWriter(magic string, version int) *Writer {
+	w := &Writer{}
+	w.String(magic)
+	w.Int(version)
+	return w
+}
+
+// Bytes は、書き込まれたバイト列を返します。
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// Uint64 は、uint64 の値を書き込みます。
+func (w *Writer) Uint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.buf.Write(b[:])
+}
+
+// Int は、int の値を書き込みます。
+func (w *Writer) Int(v int) {
+	w.Uint64(uint64(int64(v)))
+}
+
+// Int32 は、int32 の値を書き込みます。
+func (w *Writer) Int32(v int32) {
+	w.Uint64(uint64(int64(v)))
+}
+
+// Float64 は、float64 の値をビット列のまま書き込みます。
+func (w *Writer) Float64(v float64) {
+	w.Uint64(math.Float64bits(v))
+}
+
+// Bool は、bool の値を書き込みます。
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+// String は、長さを前置して文字列を書き込みます。
+func (w *Writer) String(v string) {
+	w.Int(len(v))
+	w.buf.WriteString(v)
+}
+
+// Float64s は、長さを前置して float64 のスライスを書き込みます。
+func (w *Writer) Float64s(v []float64) {
+	w.Int(len(v))
+	for _, x := range v {
+		w.Float64(x)
+	}
+}
+
+// Reader は、Writer で書き込まれたバイト列から順に値を読み出します。
+// 途中でエラーが発生した場合、以降の読み出しはすべてゼロ値を返し、Err がそのエラーを返します。
+type Reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewReader は、マジックナンバーとバージョンを検証して新しい Reader を作成します。
+func NewReader(data []byte, magic string, version int) (*Reader, error) {
+	r := &Reader{data: data}
+	if m := r.String(); r.err == nil && m != magic {
+		return nil, fmt.Errorf("binstate: unknown state format %q", m)
+	}
+	if v := r.Int(); r.err == nil && v != version {
+		return nil, fmt.Errorf("binstate: unsupported state version %d", v)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+// Err は、読み出し中に発生した最初のエラーを返します。
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Fail は、検証に失敗したことを記録します。既にエラーが記録されている場合は何もしません。
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.pos < n {
+		r.err = ErrShortState
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// Uint64 は、uint64 の値を読み出します。
+func (r *Reader) Uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// Int は、int の値を読み出します。
+func (r *Reader) Int() int {
+	return int(int64(r.Uint64()))
+}
+
+// Int32 は、int32 の値を読み出します。
+func (r *Reader) Int32() int32 {
+	return int32(int64(r.Uint64()))
+}
+
+// Float64 は、float64 の値を読み出します。
+func (r *Reader) Float64() float64 {
+	return math.Float64frombits(r.Uint64())
+}
+
+// Bool は、bool の値を読み出します。
+func (r *Reader) Bool() bool {
+	b := r.next(1)
+	return b != nil && b[0] != 0
+}
+
+// String は、文字列を読み出します。
+func (r *Reader) String() string {
+	return string(r.next(r.Int()))
+}
+
+// Float64s は、float64 のスライスを dst に読み出します。
+// 書き込まれた長さが dst の長さと異なる場合はエラーとします。
+func (r *Reader) Float64s(dst []float64) {
+	if n := r.Int(); r.err == nil && n != len(dst) {
+		r.err = fmt.Errorf("binstate: length mismatch: expected %d, got %d", len(dst), n)
+	}
+	for i := range dst {
+		dst[i] = r.Float64()
+	}
+}
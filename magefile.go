@@ -58,6 +58,21 @@ func Prof2() error {
 	return runVWithArgs("go", "run", "-gcflags", "-N -l", "cmd/fmfm-cli/*.go")
 }
 
+// Build CLI without cgo, PortAudio and PortMIDI
+func Buildheadless() error {
+	if err := os.MkdirAll(filepath.FromSlash("build/fmfm-cli-headless"), 0755); err != nil {
+		return err
+	}
+	return sh.RunWith(
+		map[string]string{
+			"CGO_ENABLED": "0",
+		},
+		"go", "build",
+		"-o", "build/fmfm-cli-headless/fmfm-cli",
+		"./cmd/fmfm-cli",
+	)
+}
+
 // Build module version
 func Buildmod() error {
 	if err := os.MkdirAll(filepath.FromSlash("build/fmfm-module"), 0755); err != nil {
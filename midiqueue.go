@@ -0,0 +1,50 @@
+package fmfm
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// midiQueue は、複数のゴルーチンから追加でき、単一のゴルーチンから取り出すことのできる、ロックを使用しないキューです。
+// 追加は常に有限のステップで完了し (wait-free)、取り出し側が追加側を待つこともありません。
+// D. Vyukov による non-intrusive MPSC node-based queue に基づきます。
+type midiQueue struct {
+	// head は、最後に追加されたノードです。追加側が atomic に更新します。
+	head unsafe.Pointer
+	// tail は、次に取り出すノードの直前のノードです。取り出し側のみが参照します。
+	tail *midiQueueNode
+}
+
+type midiQueueNode struct {
+	next unsafe.Pointer
+	msg  *midiMessage
+}
+
+func newMIDIQueue() *midiQueue {
+	stub := &midiQueueNode{}
+	return &midiQueue{
+		head: unsafe.Pointer(stub),
+		tail: stub,
+	}
+}
+
+// push は、msg を追加します。複数のゴルーチンから同時に呼び出すことができます。
+func (q *midiQueue) push(msg *midiMessage) {
+	node := &midiQueueNode{msg: msg}
+	prev := (*midiQueueNode)(atomic.SwapPointer(&q.head, unsafe.Pointer(node)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(node))
+}
+
+// pop は、最も古いメッセージを取り出します。
+// キューが空の場合、または追加の途中でまだ連結されていない場合は nil を返します。
+// 同時に呼び出すことができるのは単一のゴルーチンのみです。
+func (q *midiQueue) pop() *midiMessage {
+	next := (*midiQueueNode)(atomic.LoadPointer(&q.tail.next))
+	if next == nil {
+		return nil
+	}
+	msg := next.msg
+	next.msg = nil
+	q.tail = next
+	return msg
+}
@@ -0,0 +1,94 @@
+package fmfm
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMIDIQueue_stress(t *testing.T) {
+	const producers = 8
+	const messages = 20000
+
+	q := newMIDIQueue()
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				q.push(&midiMessage{data1: p, data2: i})
+			}
+		}(p)
+	}
+
+	next := [producers]int{}
+	received := 0
+	for received < producers*messages {
+		msg := q.pop()
+		if msg == nil {
+			runtime.Gosched()
+			continue
+		}
+		// 各ゴルーチンから追加されたメッセージは、追加された順に取り出される
+		if next[msg.data1] != msg.data2 {
+			t.Fatalf("message %d from producer %d arrived out of order", msg.data2, msg.data1)
+		}
+		next[msg.data1]++
+		received++
+	}
+	wg.Wait()
+	assert.True(t, q.pop() == nil)
+}
+
+func TestController_PushMIDIMessage_concurrent(t *testing.T) {
+	const producers = 8
+	const messages = 2000
+
+	regs := newRegisters()
+	notes := 0
+	ctrl := NewController(&ControllerOpts{
+		Registers: regs,
+		Observer: ObserverFunc(func(ev *Event) {
+			if ev.Type == EventNoteAssigned || ev.Type == EventNoteDropped {
+				notes++
+			}
+		}),
+	})
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				ctrl.PushMIDIMessage(MIDINoteOn, i, p, 60+i%12, 100)
+				ctrl.PushMIDIMessage(MIDINoteOff, i, p, 60+i%12, 0)
+			}
+		}(p)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// 音声処理のゴルーチンを模して、追加と並行してブロックを処理し続ける
+	now := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		ctrl.ScheduleBlock(64, func(i int) int {
+			return now + i
+		}, func(from, to int) {})
+		now += 64
+	}
+	ctrl.FlushMIDIMessages(messages)
+	assert.Equal(t, producers*messages, notes)
+	assert.Len(t, ctrl.midiMessages, 0)
+}
@@ -0,0 +1,95 @@
+package fmfm
+
+import (
+	"github.com/but80/fmfm.core/ymf"
+	"gopkg.in/but80/go-smaf.v1/pb/smaf"
+)
+
+// EventType は、Controller が通知するイベントの種類を表す列挙子型です。
+type EventType int
+
+const (
+	// EventNoteAssigned は、ノートが音源チャンネルに割り当てられたことを表す列挙子です。
+	EventNoteAssigned EventType = iota + 1
+	// EventVoiceStolen は、新たなノートのために発音中の音源チャンネルが奪われたことを表す列挙子です。
+	EventVoiceStolen
+	// EventNoteDropped は、空いている音源チャンネルがなくノートが発音されなかったことを表す列挙子です。
+	EventNoteDropped
+	// EventProgramNotFound は、選択されている音色が音色ライブラリに見つからなかったことを表す列挙子です。
+	EventProgramNotFound
+	// EventUnsupportedVoiceType は、音色の種類がFM音色でないため発音されなかったことを表す列挙子です。
+	EventUnsupportedVoiceType
+	// EventInvalidChipAffinity は、ControllerOpts の ChipAffinity に存在しない音源チップが指定されたため、
+	// そのMIDIチャンネルが全音源チップのチャンネルを使用することを表す列挙子です。
+	EventInvalidChipAffinity
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNoteAssigned:
+		return "NoteAssigned"
+	case EventVoiceStolen:
+		return "VoiceStolen"
+	case EventNoteDropped:
+		return "NoteDropped"
+	case EventProgramNotFound:
+		return "ProgramNotFound"
+	case EventUnsupportedVoiceType:
+		return "UnsupportedVoiceType"
+	case EventInvalidChipAffinity:
+		return "InvalidChipAffinity"
+	default:
+		return "?"
+	}
+}
+
+// Event は、Controller が通知するイベントです。
+type Event struct {
+	// Type は、イベントの種類です。
+	Type EventType
+	// MIDIChannel, Note は、イベントの原因となったノートのMIDIチャンネル番号とノート番号です。
+	MIDIChannel, Note int
+	// ChipChannel は、関係する音源チャンネルの番号です。該当しない場合は -1 です。
+	ChipChannel int
+	// StolenMIDIChannel, StolenNote は、EventVoiceStolen において、
+	// 音源チャンネルを奪われたノートのMIDIチャンネル番号とノート番号です。
+	StolenMIDIChannel, StolenNote int
+	// StolenReleased は、EventVoiceStolen において、奪われたノートがリリース中であったかどうかです。
+	StolenReleased bool
+	// BankMSB, BankLSB, Program は、関係する音色のバンクとプログラム番号です。
+	BankMSB, BankLSB, Program int
+	// VoiceType は、EventUnsupportedVoiceType において、発音できなかった音色の種類です。
+	VoiceType smaf.VoiceType
+	// Chip は、EventInvalidChipAffinity において、指定された音源チップの番号です。
+	Chip int
+}
+
+// Observer は、Controller が通知するイベントを受け取るインタフェースです。
+// Observe は Controller のロックを保持したまま呼ばれるため、その中で Controller のメソッドを呼び出してはいけません。
+type Observer interface {
+	Observe(ev *Event)
+}
+
+// ObserverFunc は、関数を Observer として扱うためのアダプタです。
+type ObserverFunc func(ev *Event)
+
+// Observe は、f(ev) を呼び出します。
+func (f ObserverFunc) Observe(ev *Event) {
+	f(ev)
+}
+
+// logObserver は、Observer が指定されていない場合に、警告となるイベントを Logger に出力する Observer です。
+type logObserver struct {
+	logger ymf.Logger
+}
+
+func (o logObserver) Observe(ev *Event) {
+	switch ev.Type {
+	case EventUnsupportedVoiceType:
+		o.logger.Printf("unsupported voice type: @%d-%d-%d note=%d type=%s", ev.BankMSB, ev.BankLSB, ev.Program, ev.Note, ev.VoiceType)
+	case EventNoteDropped:
+		o.logger.Printf("no free chip channel for MIDI channel #%d", ev.MIDIChannel)
+	case EventInvalidChipAffinity:
+		o.logger.Printf("chip #%d for MIDI channel #%d does not exist; using all chips", ev.Chip, ev.MIDIChannel)
+	}
+}
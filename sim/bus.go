@@ -0,0 +1,102 @@
+package sim
+
+import (
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+)
+
+// Send は、チャンネルの出力を送るセンドバスの種類を表す列挙子型です。
+type Send int
+
+const (
+	// SendReverb は、リバーブへのセンドバスを表す列挙子です。
+	SendReverb Send = iota
+	// SendChorus は、コーラスへのセンドバスを表す列挙子です。
+	SendChorus
+)
+
+// SendCount は、センドバスの数です。
+const SendCount = 2
+
+// busMode は、チャンネルの出力をバスに合算する方法を表す列挙子型です。
+type busMode int
+
+const (
+	// busSends は、各センドバスにセンド量に応じて合算する方法を表す列挙子です。
+	busSends busMode = iota
+	// busMIDIChannels は、チャンネルを使用しているMIDIチャンネルのバスに合算する方法を表す列挙子です。
+	busMIDIChannels
+)
+
+// bus は、チャンネルの出力を重み付けして合算した左右の信号を、
+// 主出力と同じデシメーションおよびリサンプリングを経て出力のサンプルレートに変換する経路です。
+// 主出力の演算中に内部的なサンプルレートで合算したサンプルを蓄積しておき、出力1サンプルごとに取り出します。
+type bus struct {
+	decimators  [2]*decimator
+	oversampled [2][]float64
+	resampler   *resampler
+	// sumL, sumR は、内部的なサンプルレートで合算中の左右のサンプルです。
+	sumL, sumR float64
+	// queue は、蓄積された内部的なサンプルレートのサンプルです。
+	queue [][2]float64
+	head  int
+}
+
+// newBus は、chip の主出力と同じ経路で変換する新しい bus を作成します。
+// リサンプラの位相を主出力に揃えるため、主出力と同じ回数だけ入力を取得します。
+func newBus(chip *Chip) *bus {
+	b := &bus{}
+	if 1 < chip.oversampling {
+		for i := range b.decimators {
+			b.decimators[i] = newDecimator(chip.oversampling)
+			b.oversampled[i] = make([]float64, chip.oversampling)
+		}
+	}
+	if chip.resampler != nil {
+		b.resampler = newResampler(ymfdata.SampleRate, chip.sampleRate)
+		b.resampler.frac = chip.resampler.frac
+	}
+	return b
+}
+
+// add は、チャンネルの出力 l, r に gain をかけて、合算中のサンプルに加えます。
+func (b *bus) add(l, r, gain float64) {
+	b.sumL += l * gain
+	b.sumR += r * gain
+}
+
+// commit は、合算したサンプルを蓄積し、次のサンプルの合算を始めます。
+func (b *bus) commit() {
+	b.queue = append(b.queue, [2]float64{b.sumL, b.sumR})
+	b.sumL, b.sumR = .0, .0
+}
+
+func (b *bus) pop() (float64, float64) {
+	v := b.queue[b.head]
+	b.head++
+	return v[0], v[1]
+}
+
+func (b *bus) downsample() (float64, float64) {
+	if b.decimators[0] == nil {
+		return b.pop()
+	}
+	for j := range b.oversampled[0] {
+		b.oversampled[0][j], b.oversampled[1][j] = b.pop()
+	}
+	return b.decimators[0].next(b.oversampled[0]), b.decimators[1].next(b.oversampled[1])
+}
+
+// next は、蓄積したサンプルから出力1サンプル分を得ます。
+func (b *bus) next() (float64, float64) {
+	var l, r float64
+	if b.resampler == nil {
+		l, r = b.downsample()
+	} else {
+		l, r = b.resampler.next(b.downsample)
+	}
+	if len(b.queue) <= b.head {
+		b.queue = b.queue[:0]
+		b.head = 0
+	}
+	return l, r
+}
@@ -102,6 +102,7 @@ type Channel struct {
 	expression int
 	velocity   int
 	bo         int
+	sends      [SendCount]int
 
 	feedbackBlendPrev float64
 	feedbackBlendCurr float64
@@ -111,13 +112,32 @@ type Channel struct {
 	feedback3Curr     float64
 	feedbackOut1      float64
 	feedbackOut3      float64
+	feedback1PrevInt  int32
+	feedback1CurrInt  int32
+	feedback3PrevInt  int32
+	feedback3CurrInt  int32
+	feedbackOut1Int   int32
+	feedbackOut3Int   int32
 	attenuationCoef   float64
 	modIndexFrac64    ymfdata.Frac64
+	lfo               int
 	lfoFrequency      ymfdata.Frac64
 	panCoefL          float64
 	panCoefR          float64
+	sendCoef          [SendCount]float64
 
 	operators [4]*operator
+
+	// active は、このチャンネルが Chip の発音中のチャンネルの集合に含まれているかどうかです。
+	active bool
+	// idleSince は、このチャンネルが発音を終了した時点の内部的なサンプル位置です。
+	idleSince uint64
+	// egFrom, egTo は、整数コアで次のサンプルを生成する間に進めるエンベロープのクロックの範囲です。
+	egFrom uint64
+	egTo   uint64
+
+	bufferL []float64
+	bufferR []float64
 }
 
 func newChannel(channelID int, chip *Chip) *Channel {
@@ -126,31 +146,53 @@ func newChannel(channelID int, chip *Chip) *Channel {
 		channelID: channelID,
 	}
 
+	ch.updateFeedbackBlend(chip.coreSampleRate)
+
+	for i := range ch.operators {
+		ch.operators[i] = newOperator(channelID, i, chip)
+	}
+
+	ch.resetAll()
+	return ch
+}
+
+func (ch *Channel) updateFeedbackBlend(sampleRate float64) {
 	// 48000Hz:     |prev|curr|
 	// 44100Hz: | prev | curr |
-	ch.feedbackBlendCurr = .5 * ymfdata.SampleRate / chip.sampleRate
+	ch.feedbackBlendCurr = .5 * ymfdata.SampleRate / sampleRate
 	if 1.0 < ch.feedbackBlendCurr {
 		ch.feedbackBlendCurr = 1.0
 	}
 	ch.feedbackBlendPrev = 1.0 - ch.feedbackBlendCurr
+}
 
-	for i := range ch.operators {
-		ch.operators[i] = newOperator(channelID, i, chip)
+// setSampleRate は、チャンネルを演算するサンプルレートを変更します。
+func (ch *Channel) setSampleRate(sampleRate float64) {
+	ch.updateFeedbackBlend(sampleRate)
+	// 変更前のサンプルレートで演算を省略した分の位相を進めてから、増分を換算し直す
+	ch.syncLFO()
+	ch.updateLFOFrequency()
+	for _, op := range ch.operators {
+		op.setSampleRate(sampleRate)
 	}
-
-	ch.resetAll()
-	return ch
 }
 
 func (ch *Channel) reset() {
 	// TODO: モジュレーションは発音ごとにリセットされるのか？
 	ch.modIndexFrac64 = 0
+	ch.idleSince = ch.chip.coreSamples
 	ch.feedback1Prev = .0
 	ch.feedback1Curr = .0
 	ch.feedback3Prev = .0
 	ch.feedback3Curr = .0
 	ch.feedbackOut1 = .0
 	ch.feedbackOut3 = .0
+	ch.feedback1PrevInt = 0
+	ch.feedback1CurrInt = 0
+	ch.feedback3PrevInt = 0
+	ch.feedback3CurrInt = 0
+	ch.feedbackOut1Int = 0
+	ch.feedbackOut3Int = 0
 	for _, op := range ch.operators {
 		op.phaseGenerator.reset()
 		op.envelopeGenerator.reset()
@@ -169,6 +211,9 @@ func (ch *Channel) resetAll() {
 	ch.expression = 127
 	ch.velocity = 0
 	ch.bo = 1
+	for i := range ch.sends {
+		ch.setSend(Send(i), 0)
+	}
 	ch.setLFO(0)
 	ch.updatePanCoef()
 	ch.updateAttenuation()
@@ -189,6 +234,32 @@ func (ch *Channel) isOff() bool {
 	return true
 }
 
+// activate は、このチャンネルを発音中のチャンネルの集合に加えます。
+func (ch *Channel) activate() {
+	if ch.active {
+		return
+	}
+	ch.syncLFO()
+	ch.active = true
+	ch.chip.addActiveChannel(ch)
+}
+
+// deactivate は、このチャンネルが内部的なサンプル位置 at で発音を終了したことを記録します。
+// 発音中のチャンネルの集合からは、Chip が次のサンプルを生成する際に取り除かれます。
+func (ch *Channel) deactivate(at uint64) {
+	ch.active = false
+	ch.idleSince = at
+}
+
+// syncLFO は、発音していない間に演算を省略したサンプル数だけ LFO の位相を進めます。
+func (ch *Channel) syncLFO() {
+	if ch.active {
+		return
+	}
+	ch.modIndexFrac64 += ch.lfoFrequency * ymfdata.Frac64(ch.chip.coreSamples-ch.idleSince)
+	ch.idleSince = ch.chip.coreSamples
+}
+
 func (ch *Channel) currentLevel() float64 {
 	result := .0
 	for i, op := range ch.operators {
@@ -251,6 +322,7 @@ func (ch *Channel) keyOn() {
 		op.keyOn()
 	}
 	ch.kon = 1
+	ch.activate()
 }
 
 func (ch *Channel) keyOff() {
@@ -282,13 +354,25 @@ func (ch *Channel) setALG(v int) {
 	ch.feedback1Curr = 0
 	ch.feedback3Prev = 0
 	ch.feedback3Curr = 0
+	ch.feedback1PrevInt = 0
+	ch.feedback1CurrInt = 0
+	ch.feedback3PrevInt = 0
+	ch.feedback3CurrInt = 0
 	for i, op := range ch.operators {
 		op.isModulator = ymfdata.ModulatorMatrix[ch.alg][i]
 	}
 }
 
 func (ch *Channel) setLFO(v int) {
-	ch.lfoFrequency = ymfdata.LFOFrequency[v]
+	ch.syncLFO()
+	ch.lfo = v
+	ch.updateLFOFrequency()
+}
+
+// updateLFOFrequency は、48kHz を前提とする LFOFrequency を内部的なサンプルレートにおける増分に換算し、
+// サンプルレートやオーバーサンプリングの倍率によらず LFO が本来の周波数で進むようにします。
+func (ch *Channel) updateLFOFrequency() {
+	ch.lfoFrequency = ymfdata.Frac64(float64(ymfdata.LFOFrequency[ch.lfo]) * ymfdata.SampleRate / ch.chip.coreSampleRate)
 }
 
 func (ch *Channel) setPANPOT(v int) {
@@ -302,14 +386,7 @@ func (ch *Channel) setCHPAN(v int) {
 }
 
 func (ch *Channel) updatePanCoef() {
-	pan := ch.chpan + (ch.panpot-15)*4
-	if pan < 0 {
-		pan = 0
-	} else if 127 < pan {
-		pan = 127
-	}
-	ch.panCoefL = ymfdata.PanTable[pan][0]
-	ch.panCoefR = ymfdata.PanTable[pan][1]
+	ch.panCoefL, ch.panCoefR = ch.chip.tables.panCoef(ch.chip.profile, ch.chpan, ch.panpot)
 }
 
 func (ch *Channel) setVOLUME(v int) {
@@ -331,12 +408,25 @@ func (ch *Channel) updateAttenuation() {
 	ch.attenuationCoef = ymfdata.VolumeTable[ch.volume>>2] * ymfdata.VolumeTable[ch.expression>>2] * ymfdata.VolumeTable[ch.velocity>>2]
 }
 
+// setSend は、センドバス send へのセンド量を設定します。
+// センド量は、VOLUME と同じカーブで振幅の倍率に換算します。
+func (ch *Channel) setSend(send Send, v int) {
+	ch.sends[send] = v
+	ch.sendCoef[send] = ymfdata.VolumeTable[v>>2]
+}
+
 func (ch *Channel) setBO(v int) {
 	ch.bo = v
 	ch.updateFrequency()
 }
 
+// next は、次のサンプルを生成します。
+// キャリアがすべて発音を終了している場合は呼び出さないでください。
 func (ch *Channel) next() (float64, float64) {
+	if ch.chip.integerCore {
+		return ch.nextInt()
+	}
+
 	var result float64
 	var op1out float64
 	var op2out float64
@@ -355,9 +445,6 @@ func (ch *Channel) next() (float64, float64) {
 
 	case 0:
 		// (FB)1 -> 2 -> OUT
-		if op2.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 
@@ -366,9 +453,6 @@ func (ch *Channel) next() (float64, float64) {
 	case 1:
 		// (FB)1 -> | -> OUT
 		//     2 -> |
-		if op1.envelopeGenerator.stage == stageOff && op2.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, noModulator)
@@ -380,12 +464,6 @@ func (ch *Channel) next() (float64, float64) {
 		//     2 -> |
 		// (FB)3 -> |
 		//     4 -> |
-		if op1.envelopeGenerator.stage == stageOff &&
-			op2.envelopeGenerator.stage == stageOff &&
-			op3.envelopeGenerator.stage == stageOff &&
-			op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, noModulator)
@@ -397,9 +475,6 @@ func (ch *Channel) next() (float64, float64) {
 	case 3:
 		// (FB)OP1 --------> | -> OP4 -> OUT
 		//     OP2 -> OP3 -> |
-		if op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, noModulator)
@@ -409,9 +484,6 @@ func (ch *Channel) next() (float64, float64) {
 
 	case 4:
 		// (FB)OP1 -> OP2 -> OP3 -> OP4 -> OUT
-		if op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, op1out*ymfdata.ModulatorMultiplier)
@@ -422,9 +494,6 @@ func (ch *Channel) next() (float64, float64) {
 	case 5:
 		// (FB)OP1 -> OP2 -> | -> OUT
 		// (FB)OP3 -> OP4 -> |
-		if op2.envelopeGenerator.stage == stageOff && op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, op1out*ymfdata.ModulatorMultiplier)
@@ -437,9 +506,6 @@ func (ch *Channel) next() (float64, float64) {
 	case 6:
 		// (FB)OP1 ---------------> | -> OUT
 		//     OP2 -> OP3 -> OP4 -> |
-		if op1.envelopeGenerator.stage == stageOff && op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, noModulator)
@@ -452,11 +518,6 @@ func (ch *Channel) next() (float64, float64) {
 		// (FB)OP1 --------> | -> OUT
 		//     OP2 -> OP3 -> |
 		//     OP4 --------> |
-		if op1.envelopeGenerator.stage == stageOff &&
-			op3.envelopeGenerator.stage == stageOff &&
-			op4.envelopeGenerator.stage == stageOff {
-			return 0, 0
-		}
 
 		op1out = op1.next(modIndex, ch.feedbackOut1)
 		op2out = op2.next(modIndex, noModulator)
@@ -482,6 +543,152 @@ func (ch *Channel) next() (float64, float64) {
 	return result * ch.panCoefL, result * ch.panCoefR
 }
 
+// nextInt は、整数コアで次のサンプルを生成します。
+// オペレータ間の変調とフィードバックは整数のまま行い、
+// チャンネル出力の段階で浮動小数点数に変換します。
+func (ch *Channel) nextInt() (float64, float64) {
+	var result int32
+	var op1out int32
+	var op2out int32
+	var op3out int32
+	var op4out int32
+
+	op1 := ch.operators[0]
+	op2 := ch.operators[1]
+	op3 := ch.operators[2]
+	op4 := ch.operators[3]
+
+	modIndex := int(ch.modIndexFrac64 >> ymfdata.ModTableIndexShift)
+	ch.modIndexFrac64 += ch.lfoFrequency
+
+	switch ch.alg {
+
+	case 0:
+		// (FB)1 -> 2 -> OUT
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+
+		result = op2.nextInt(modIndex, op1out, ch.egFrom, ch.egTo)
+
+	case 1:
+		// (FB)1 -> | -> OUT
+		//     2 -> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+
+		result = op1out + op2out
+
+	case 2:
+		// (FB)1 -> | -> OUT
+		//     2 -> |
+		// (FB)3 -> |
+		//     4 -> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+		op3out = op3.nextInt(modIndex, ch.feedbackOut3Int, ch.egFrom, ch.egTo)
+		op4out = op4.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+
+		result = op1out + op2out + op3out + op4out
+
+	case 3:
+		// (FB)OP1 --------> | -> OP4 -> OUT
+		//     OP2 -> OP3 -> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+		op3out = op3.nextInt(modIndex, op2out, ch.egFrom, ch.egTo)
+
+		result = op4.nextInt(modIndex, op1out+op3out, ch.egFrom, ch.egTo)
+
+	case 4:
+		// (FB)OP1 -> OP2 -> OP3 -> OP4 -> OUT
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, op1out, ch.egFrom, ch.egTo)
+		op3out = op3.nextInt(modIndex, op2out, ch.egFrom, ch.egTo)
+
+		result = op4.nextInt(modIndex, op3out, ch.egFrom, ch.egTo)
+
+	case 5:
+		// (FB)OP1 -> OP2 -> | -> OUT
+		// (FB)OP3 -> OP4 -> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, op1out, ch.egFrom, ch.egTo)
+
+		op3out = op3.nextInt(modIndex, ch.feedbackOut3Int, ch.egFrom, ch.egTo)
+		op4out = op4.nextInt(modIndex, op3out, ch.egFrom, ch.egTo)
+
+		result = op2out + op4out
+
+	case 6:
+		// (FB)OP1 ---------------> | -> OUT
+		//     OP2 -> OP3 -> OP4 -> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+		op3out = op3.nextInt(modIndex, op2out, ch.egFrom, ch.egTo)
+		op4out = op4.nextInt(modIndex, op3out, ch.egFrom, ch.egTo)
+
+		result = op1out + op4out
+
+	case 7:
+		// (FB)OP1 --------> | -> OUT
+		//     OP2 -> OP3 -> |
+		//     OP4 --------> |
+
+		op1out = op1.nextInt(modIndex, ch.feedbackOut1Int, ch.egFrom, ch.egTo)
+		op2out = op2.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+		op3out = op3.nextInt(modIndex, op2out, ch.egFrom, ch.egTo)
+		op4out = op4.nextInt(modIndex, noModulator, ch.egFrom, ch.egTo)
+
+		result = op1out + op3out + op4out
+	}
+
+	// 直近2サンプルの和を (9 - FB) ビット右シフトして位相に加算する
+	if op1.fb != 0 {
+		ch.feedback1PrevInt = ch.feedback1CurrInt
+		ch.feedback1CurrInt = op1out
+		ch.feedbackOut1Int = (ch.feedback1PrevInt + ch.feedback1CurrInt) >> uint(9-op1.fb)
+	}
+
+	if op3.fb != 0 {
+		ch.feedback3PrevInt = ch.feedback3CurrInt
+		ch.feedback3CurrInt = op3out
+		ch.feedbackOut3Int = (ch.feedback3PrevInt + ch.feedback3CurrInt) >> uint(9-op3.fb)
+	}
+
+	v := float64(result) / ymfdata.IntFullScale * ch.attenuationCoef
+	return v * ch.panCoefL, v * ch.panCoefR
+}
+
+// render は、内部的なサンプル位置 start から n サンプル分の波形を並列レンダリング用のバッファに生成します。
+// 途中で発音が終了した場合は、残りを無音で埋めます。
+func (ch *Channel) render(n int, start uint64) {
+	ch.ensureBuffer(n)
+	for i := 0; i < n; i++ {
+		if ch.isOff() {
+			ch.deactivate(start + uint64(i))
+			for ; i < n; i++ {
+				ch.bufferL[i], ch.bufferR[i] = .0, .0
+			}
+			return
+		}
+		ch.egFrom, ch.egTo = ch.chip.egClocksAt[i], ch.chip.egClocksAt[i+1]
+		ch.bufferL[i], ch.bufferR[i] = ch.next()
+	}
+}
+
+// ensureBuffer は、並列レンダリング用のバッファを n サンプル分以上確保します。
+func (ch *Channel) ensureBuffer(n int) {
+	if len(ch.bufferL) < n {
+		ch.bufferL = make([]float64, n)
+		ch.bufferR = make([]float64, n)
+	}
+}
+
 func (ch *Channel) updateFrequency() {
 	for _, op := range ch.operators {
 		op.setFrequency(ch.fnum, ch.block, ch.bo)
@@ -0,0 +1,34 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannel_lfoFrequency(t *testing.T) {
+	for _, oversampling := range []int{1, 2, 4} {
+		chip := NewChip(44100.0, .0, -1, nil).SetOversampling(oversampling)
+		regs := NewRegisters(chip)
+		regs.WriteChannel(0, ymf.LFO, 3)
+		for i := 0; i < 4; i++ {
+			regs.WriteOperator(0, i, ymf.MULT, 1)
+			regs.WriteOperator(0, i, ymf.AR, 15)
+			regs.WriteOperator(0, i, ymf.EVB, 1)
+		}
+		regs.WriteChannel(0, ymf.FNUM, 300)
+		regs.WriteChannel(0, ymf.BLOCK, 4)
+		regs.WriteChannel(0, ymf.KON, 1)
+
+		l := make([]float64, 4410)
+		r := make([]float64, 4410)
+		chip.Render(l, r)
+		ch := chip.channels[0]
+		assert.True(t, ch.active)
+		// LFO=3 は、44.1kHz でもオーバーサンプリングの倍率によらず 7Hz
+		hz := float64(ch.modIndexFrac64) / ymfdata.Pow64Of2 / .1
+		assert.InDelta(t, 7.0, hz, 1e-2, "oversampling=%d", oversampling)
+	}
+}
@@ -1,11 +1,11 @@
 package sim
 
 import (
-	"fmt"
 	"math"
 	"sort"
 	"sync"
 
+	"github.com/but80/fmfm.core/ymf"
 	"github.com/but80/fmfm.core/ymf/ymfdata"
 )
 
@@ -14,75 +14,495 @@ type Chip struct {
 	Mutex sync.Mutex
 	// sampleRate は、出力波形の目標サンプルレートです。
 	sampleRate float64
+	// coreSampleRate は、チャンネルおよびオペレータを演算する内部的なサンプルレートです。
+	coreSampleRate float64
 	// totalLevel は、出力のトータルな音量[dB]です。
 	totalLevel float64
+	// totalLevelCoef は、totalLevel を振幅の倍率に換算した値です。
+	totalLevelCoef float64
 	// dumpMIDIChannel は、ダンプ表示対象のMIDIチャンネルです。未使用時は -1 です。
 	dumpMIDIChannel int
+	// logger は、ダンプ表示および警告の出力先です。
+	logger ymf.Logger
 	// channels は、このチップが備える全チャンネルです。
 	channels []*Channel
+	// activeChannels は、発音中のチャンネルをチャンネル番号順に並べたものです。
+	// 発音していないチャンネルは演算を省略します。
+	activeChannels []*Channel
+	// coreSamples は、内部的なサンプルレートで生成したサンプル数です。
+	coreSamples uint64
+	// egClocks は、整数コアのエンベロープを駆動する、チップ固有のサンプルレートで数えたクロック数です。
+	egClocks uint64
+	// egFrac は、egClocks の端数を32bitの固定小数点数で表したものです。
+	egFrac uint64
+	// egStep は、内部的なサンプル1つあたりに進めるクロック数を32bitの固定小数点数で表したものです。
+	egStep uint64
+	// egClocksAt は、並列レンダリング時に各サンプルの開始時点の egClocks を保持するバッファです。
+	egClocksAt []uint64
+	// profile は、エミュレーション対象のチップの特性です。
+	profile *Profile
+	// tables は、profile から生成されたテーブルです。
+	tables *profileTables
+	// integerCore は、オペレータを対数領域の整数演算で演算するかどうかです。
+	integerCore bool
+	// bandLimited は、オペレータの周波数に応じて帯域制限された波形テーブルを使用するかどうかです。
+	bandLimited bool
+	// parallel は、Render でチャンネルを並列にレンダリングするゴルーチンの数です。
+	parallel int
+	// oversampling は、出力のサンプルレートに対する内部的なサンプルレートの倍率です。
+	oversampling int
+	// decimators は、オーバーサンプリング時に左右それぞれの出力を間引くフィルタです。
+	decimators [2]*decimator
+	// oversampled は、オーバーサンプリング時に出力1サンプル分の左右の入力を保持するバッファです。
+	oversampled [2][]float64
+	// nativeRate は、チップ本来のサンプルレートで内部的に演算するかどうかです。
+	nativeRate bool
+	// resampler は、nativeRate 時に内部的なサンプルレートから出力のサンプルレートへ変換するリサンプラです。
+	resampler *resampler
+	// resampleSource は、並列レンダリング時にリサンプラへ入力するサンプルのインデックスです。
+	resampleSource int
+	// buses は、busMode に従ってチャンネルの出力を合算するバスの経路です。
+	// RenderWithSends または RenderMIDIChannels の呼び出しで必要に応じて作成します。
+	buses []*bus
+	// busMode は、buses にチャンネルの出力を合算する方法です。
+	busMode busMode
+	// mixBuses は、チャンネルの出力を buses にも合算するかどうかです。
+	mixBuses bool
 
 	currentOutput []float64
 }
 
 // NewChip は、新しい Chip を作成します。
-func NewChip(sampleRate, totalLevel float64, dumpMIDIChannel int) *Chip {
+// profile が nil の場合は ProfileMA5 を使用します。
+func NewChip(sampleRate, totalLevel float64, dumpMIDIChannel int, profile *Profile) *Chip {
+	if profile == nil {
+		profile = ProfileMA5
+	}
 	chip := &Chip{
 		sampleRate:      sampleRate,
+		coreSampleRate:  sampleRate,
 		totalLevel:      totalLevel,
+		totalLevelCoef:  math.Pow(10, totalLevel/20),
 		dumpMIDIChannel: dumpMIDIChannel,
-		channels:        make([]*Channel, ymfdata.ChannelCount),
+		logger:          ymf.DefaultLogger,
+		profile:         profile,
+		tables:          profile.tables(),
+		oversampling:    1,
 		currentOutput:   make([]float64, 2),
 	}
+	chip.updateEGStep()
 	chip.initChannels()
 	return chip
 }
 
 var debugDumpCount = 0
 
+// Profile は、このチップに設定されているプロファイルを返します。
+func (chip *Chip) Profile() *Profile {
+	return chip.profile
+}
+
+// ChannelCount は、このチップが備えるチャンネル数を返します。
+func (chip *Chip) ChannelCount() int {
+	return len(chip.channels)
+}
+
 // SampleRate は、このチップに設定されているサンプルレートを返します。
 func (chip *Chip) SampleRate() float64 {
 	return chip.sampleRate
 }
 
+// SetIntegerCore は、オペレータの演算に整数コアを使用するかどうかを設定します。
+// 整数コアは、YMF262 のダイから読み出された対数サインテーブルと指数テーブル、
+// 9bitの減衰量を持つエンベロープカウンタおよびキースケーリングのテーブルを用い、
+// オペレータ間の変調とフィードバックを整数のまま演算します。エンベロープカウンタは、
+// 内部的なサンプルレートによらずチップ固有のサンプルレートのクロックで進みます。
+// 位相の増分、WS 8 以降の波形、トレモロの深さ、チャンネルの音量とパンは浮動小数点数の演算と共通です。
+// YMF825 が YMF262 と同じテーブルを持つことは実機の出力で確認されていません。
+func (chip *Chip) SetIntegerCore(v bool) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.integerCore = v
+	return chip
+}
+
+// SetBandLimited は、オペレータの周波数に応じて1オクターブごとに帯域制限された
+// 波形テーブルを使用するかどうかを設定します。
+// 有効な場合、不連続点を持つ波形で生じる折り返し雑音を抑えます。
+func (chip *Chip) SetBandLimited(v bool) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.bandLimited = v
+	for _, channel := range chip.channels {
+		for _, op := range channel.operators {
+			op.updateWaveform()
+		}
+	}
+	return chip
+}
+
+// SetParallel は、Render でチャンネルを並列にレンダリングするゴルーチンの数を設定します。
+// 1 以下の場合は直列にレンダリングします。並列時も出力は直列時と完全に一致します。
+func (chip *Chip) SetParallel(n int) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.parallel = n
+	return chip
+}
+
+// SetOversampling は、出力のサンプルレートの factor 倍で内部的に演算するよう設定します。
+// factor が 2 以上の場合、ポリフェーズのデシメーションフィルタで帯域制限してから間引くことで、
+// MULT やフィードバックの大きい音色で生じる折り返し雑音を抑えます。
+func (chip *Chip) SetOversampling(factor int) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	if factor < 1 {
+		factor = 1
+	}
+	chip.oversampling = factor
+	chip.buses = nil
+	for i := range chip.decimators {
+		chip.decimators[i] = nil
+		chip.oversampled[i] = nil
+		if 1 < factor {
+			chip.decimators[i] = newDecimator(factor)
+			chip.oversampled[i] = make([]float64, factor)
+		}
+	}
+	chip.updateCoreSampleRate()
+	return chip
+}
+
+// SetNativeRate は、出力のサンプルレートによらず、チップ本来のサンプルレート
+// (ymfdata.SampleRate) で内部的に演算するかどうかを設定します。
+// 有効な場合、合算後の出力を帯域制限付きのリサンプラで出力のサンプルレートに変換するため、
+// フィードバックの挙動やエンベロープのタイミングがサンプルレートによらず一致します。
+func (chip *Chip) SetNativeRate(v bool) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.nativeRate = v
+	chip.resampler = nil
+	chip.buses = nil
+	if v && chip.sampleRate != ymfdata.SampleRate {
+		chip.resampler = newResampler(ymfdata.SampleRate, chip.sampleRate)
+	}
+	chip.updateCoreSampleRate()
+	return chip
+}
+
+// SetLogger は、ダンプ表示および範囲外のチャンネルへの書き込みなどの警告の出力先を設定します。
+// nil を指定した場合は何も出力しません。
+func (chip *Chip) SetLogger(logger ymf.Logger) *Chip {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	if logger == nil {
+		logger = ymf.NopLogger
+	}
+	chip.logger = logger
+	return chip
+}
+
+func (chip *Chip) updateCoreSampleRate() {
+	baseRate := chip.sampleRate
+	if chip.nativeRate {
+		baseRate = ymfdata.SampleRate
+	}
+	chip.coreSampleRate = baseRate * float64(chip.oversampling)
+	chip.updateEGStep()
+	for _, channel := range chip.channels {
+		channel.setSampleRate(chip.coreSampleRate)
+	}
+}
+
+// updateEGStep は、内部的なサンプルレートから egStep を求めます。
+func (chip *Chip) updateEGStep() {
+	chip.egStep = uint64(math.Floor(ymfdata.SampleRate/chip.coreSampleRate*(1<<32) + .5))
+}
+
+// advanceEGClock は、内部的なサンプル1つ分 egClocks を進めます。
+func (chip *Chip) advanceEGClock() {
+	chip.egFrac += chip.egStep
+	chip.egClocks += chip.egFrac >> 32
+	chip.egFrac &= 1<<32 - 1
+}
+
 // Next は、次のサンプルを生成し、その左右それぞれの振幅を返します。
 func (chip *Chip) Next() (float64, float64) {
+	chip.Mutex.Lock()
+	chip.buses = nil
+	l, r := chip.nextNative()
+	chip.Mutex.Unlock()
+	chip.debugDump()
+	return chip.output(l, r)
+}
+
+// nextNative は、必要に応じてリサンプラを通し、出力のサンプルレートで次のサンプルを生成します。
+func (chip *Chip) nextNative() (float64, float64) {
+	if chip.resampler == nil {
+		return chip.downsample(chip.mixChannels, 0)
+	}
+	return chip.resampler.next(chip.nextNativeSource)
+}
+
+func (chip *Chip) nextNativeSource() (float64, float64) {
+	return chip.downsample(chip.mixChannels, 0)
+}
+
+func (chip *Chip) nextBufferedSource() (float64, float64) {
+	i := chip.resampleSource
+	chip.resampleSource++
+	return chip.downsample(chip.mixBuffers, i*chip.oversampling)
+}
+
+// mixChannels は、発音中の全チャンネルの次のサンプルを内部的なサンプルレートで生成し、合算します。
+// 発音を終了したチャンネルは、発音中のチャンネルの集合から取り除きます。
+func (chip *Chip) mixChannels(int) (float64, float64) {
 	var l, r float64
-	for _, channel := range chip.channels {
-		chip.Mutex.Lock()
+	egFrom := chip.egClocks
+	chip.advanceEGClock()
+	active := chip.activeChannels[:0]
+	for _, channel := range chip.activeChannels {
+		if channel.isOff() {
+			channel.deactivate(chip.coreSamples)
+			continue
+		}
+		active = append(active, channel)
+		channel.egFrom, channel.egTo = egFrom, chip.egClocks
 		cl, cr := channel.next()
-		chip.Mutex.Unlock()
 		l += cl
 		r += cr
+		if chip.mixBuses {
+			chip.addToBuses(channel, cl, cr)
+		}
 	}
-	v := math.Pow(10, chip.totalLevel/20)
-
-	if 0 <= chip.dumpMIDIChannel {
-		debugDumpCount++
-		if int(chip.sampleRate/ymfdata.DebugDumpFPS) <= debugDumpCount {
-			debugDumpCount = 0
-			toDump := []*Channel{}
-			for _, ch := range chip.channels {
-				if ch.midiChannelID == chip.dumpMIDIChannel && epsilon < ch.currentLevel() {
-					toDump = append(toDump, ch)
-				}
-			}
-			if 0 < len(toDump) {
-				sort.Slice(toDump, func(i, j int) bool {
-					return toDump[i].currentLevel() < toDump[j].currentLevel()
-				})
-				for _, ch := range toDump {
-					fmt.Print(ch.dump())
-				}
-				fmt.Println("------------------------------")
+	chip.activeChannels = active
+	chip.coreSamples++
+	chip.commitBuses()
+	return l, r
+}
+
+// mixBuffers は、並列レンダリングで各チャンネルのバッファに生成されたサンプルを合算します。
+func (chip *Chip) mixBuffers(i int) (float64, float64) {
+	var l, r float64
+	for _, channel := range chip.activeChannels {
+		l += channel.bufferL[i]
+		r += channel.bufferR[i]
+		if chip.mixBuses {
+			chip.addToBuses(channel, channel.bufferL[i], channel.bufferR[i])
+		}
+	}
+	chip.commitBuses()
+	return l, r
+}
+
+// addToBuses は、チャンネルの出力 l, r を busMode に従って各バスに合算します。
+func (chip *Chip) addToBuses(channel *Channel, l, r float64) {
+	switch chip.busMode {
+	case busSends:
+		for k, b := range chip.buses {
+			b.add(l, r, channel.sendCoef[k])
+		}
+	case busMIDIChannels:
+		if m := channel.midiChannelID; 0 <= m && m < len(chip.buses) {
+			chip.buses[m].add(l, r, 1.0)
+		}
+	}
+}
+
+// commitBuses は、各バスに合算した内部的なサンプルレートのサンプルを蓄積します。
+func (chip *Chip) commitBuses() {
+	if !chip.mixBuses {
+		return
+	}
+	for _, b := range chip.buses {
+		b.commit()
+	}
+}
+
+// downsample は、mix により内部的なサンプルレートで生成したサンプルから、出力1サンプル分を得ます。
+// base は、mix に渡す内部的なサンプルのインデックスの起点です。
+func (chip *Chip) downsample(mix func(i int) (float64, float64), base int) (float64, float64) {
+	if chip.oversampling <= 1 {
+		return mix(base)
+	}
+	for j := 0; j < chip.oversampling; j++ {
+		chip.oversampled[0][j], chip.oversampled[1][j] = mix(base + j)
+	}
+	return chip.decimators[0].next(chip.oversampled[0]), chip.decimators[1].next(chip.oversampled[1])
+}
+
+// Render は、len(outL) サンプル分の波形を生成し、左右それぞれの振幅を outL, outR に書き込みます。
+// ブロックの生成中はレジスタへの書き込みをブロックします。
+func (chip *Chip) Render(outL, outR []float64) {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	// バスへの合算を省略したため、次にバスを出力する際に作成し直す
+	chip.buses = nil
+	chip.render(outL, outR, nil, nil)
+}
+
+// RenderWithSends は、Render と同様に波形を生成し、さらに各チャンネルの出力を
+// REVERB, CHORUS レジスタのセンド量で合算したセンドバスの信号を、sendL[k], sendR[k] に書き込みます。
+// sendL, sendR は、Send の値をインデックスとする SendCount 個のバッファです。
+// センドバスの信号はトータルの音量を含み、出力の量子化は含みません。
+func (chip *Chip) RenderWithSends(outL, outR []float64, sendL, sendR [][]float64) {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.renderBuses(busSends, outL, outR, sendL, sendR)
+}
+
+// RenderMIDIChannels は、Render と同様に波形を生成し、さらにMIDIチャンネル m を使用している
+// 各チャンネルの出力を合算した信号を、busL[m], busR[m] に書き込みます。
+// busL, busR は、MIDIチャンネルの数だけのバッファです。範囲外のMIDIチャンネルの出力は書き込みません。
+// 各バスの信号はトータルの音量を含み、出力の量子化は含みません。
+func (chip *Chip) RenderMIDIChannels(outL, outR []float64, busL, busR [][]float64) {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	chip.renderBuses(busMIDIChannels, outL, outR, busL, busR)
+}
+
+// renderBuses は、mode に従ってチャンネルの出力をバスに合算しながら波形を生成します。
+func (chip *Chip) renderBuses(mode busMode, outL, outR []float64, busL, busR [][]float64) {
+	if chip.busMode != mode || len(chip.buses) != len(busL) {
+		chip.buses = nil
+	}
+	if chip.buses == nil {
+		chip.busMode = mode
+		chip.buses = make([]*bus, len(busL))
+		for k := range chip.buses {
+			chip.buses[k] = newBus(chip)
+		}
+	}
+	chip.mixBuses = true
+	chip.render(outL, outR, busL, busR)
+	chip.mixBuses = false
+}
+
+// render は、Render および renderBuses の本体です。busL が nil の場合はバスを出力しません。
+func (chip *Chip) render(outL, outR []float64, busL, busR [][]float64) {
+	if chip.parallel <= 1 {
+		for i := range outL {
+			l, r := chip.nextNative()
+			chip.debugDump()
+			outL[i], outR[i] = chip.output(l, r)
+			chip.outputBuses(busL, busR, i)
+		}
+		return
+	}
+
+	// チャンネルごとのバッファにレンダリングした後、直列時と同じ順序で加算する
+	n := len(outL)
+	if chip.resampler != nil {
+		n = chip.resampler.inputsNeeded(n)
+	}
+	n *= chip.oversampling
+	if len(chip.egClocksAt) < n+1 {
+		chip.egClocksAt = make([]uint64, n+1)
+	}
+	chip.egClocksAt[0] = chip.egClocks
+	for i := 1; i <= n; i++ {
+		chip.advanceEGClock()
+		chip.egClocksAt[i] = chip.egClocks
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < chip.parallel; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for c := g; c < len(chip.activeChannels); c += chip.parallel {
+				chip.activeChannels[c].render(n, chip.coreSamples)
 			}
+		}(g)
+	}
+	wg.Wait()
+
+	chip.resampleSource = 0
+	for i := range outL {
+		var l, r float64
+		if chip.resampler == nil {
+			l, r = chip.downsample(chip.mixBuffers, i*chip.oversampling)
+		} else {
+			l, r = chip.resampler.next(chip.nextBufferedSource)
+		}
+		chip.debugDump()
+		outL[i], outR[i] = chip.output(l, r)
+		chip.outputBuses(busL, busR, i)
+	}
+
+	chip.coreSamples += uint64(n)
+	active := chip.activeChannels[:0]
+	for _, channel := range chip.activeChannels {
+		if channel.active {
+			active = append(active, channel)
 		}
 	}
+	chip.activeChannels = active
+}
+
+// addActiveChannel は、チャンネル番号順を保って発音中のチャンネルの集合に ch を加えます。
+func (chip *Chip) addActiveChannel(ch *Channel) {
+	i := sort.Search(len(chip.activeChannels), func(i int) bool {
+		return ch.channelID < chip.activeChannels[i].channelID
+	})
+	chip.activeChannels = append(chip.activeChannels, nil)
+	copy(chip.activeChannels[i+1:], chip.activeChannels[i:])
+	chip.activeChannels[i] = ch
+}
+
+// ActiveChannelCount は、発音中のチャンネル数を返します。
+func (chip *Chip) ActiveChannelCount() int {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+	return len(chip.activeChannels)
+}
+
+// output は、全チャンネルを合算した振幅にトータルの音量と出力の量子化を適用します。
+func (chip *Chip) output(l, r float64) (float64, float64) {
+	v := chip.totalLevelCoef
+	return chip.tables.quantizeOutput(l * v), chip.tables.quantizeOutput(r * v)
+}
+
+// outputBuses は、各バスの出力1サンプル分にトータルの音量を適用し、busL[k][i], busR[k][i] に書き込みます。
+func (chip *Chip) outputBuses(busL, busR [][]float64, i int) {
+	if busL == nil {
+		return
+	}
+	v := chip.totalLevelCoef
+	for k, b := range chip.buses {
+		l, r := b.next()
+		busL[k][i], busR[k][i] = l*v, r*v
+	}
+}
 
-	return l * v, r * v
+func (chip *Chip) debugDump() {
+	if chip.dumpMIDIChannel < 0 {
+		return
+	}
+	debugDumpCount++
+	if debugDumpCount < int(chip.sampleRate/ymfdata.DebugDumpFPS) {
+		return
+	}
+	debugDumpCount = 0
+	toDump := []*Channel{}
+	for _, ch := range chip.channels {
+		if ch.midiChannelID == chip.dumpMIDIChannel && epsilon < ch.currentLevel() {
+			toDump = append(toDump, ch)
+		}
+	}
+	if 0 < len(toDump) {
+		sort.Slice(toDump, func(i, j int) bool {
+			return toDump[i].currentLevel() < toDump[j].currentLevel()
+		})
+		dump := ""
+		for _, ch := range toDump {
+			dump += ch.dump()
+		}
+		chip.logger.Printf("%s------------------------------", dump)
+	}
 }
 
 func (chip *Chip) initChannels() {
-	chip.channels = make([]*Channel, ymfdata.ChannelCount)
+	chip.channels = make([]*Channel, chip.profile.ChannelCount)
 	for i := range chip.channels {
 		chip.channels[i] = newChannel(i, chip)
 	}
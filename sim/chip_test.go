@@ -1,11 +1,14 @@
 package sim_test
 
 import (
+	"fmt"
 	"testing"
 
 	fmfm "github.com/but80/fmfm.core"
 	"github.com/but80/fmfm.core/sim"
+	"github.com/but80/fmfm.core/ymf"
 	fuzz "github.com/google/gofuzz"
+	"github.com/stretchr/testify/assert"
 	"gopkg.in/but80/go-smaf.v1/pb/smaf"
 )
 
@@ -28,7 +31,7 @@ func TestNewChip(t *testing.T) {
 		lib.Normalize()
 
 		func() {
-			chip := sim.NewChip(sampleRate, -15.0, -1)
+			chip := sim.NewChip(sampleRate, -15.0, -1, nil)
 			regs := sim.NewRegisters(chip)
 			opts := &fmfm.ControllerOpts{
 				Registers: regs,
@@ -57,3 +60,276 @@ func TestNewChip(t *testing.T) {
 		}()
 	}
 }
+
+func TestChip_Render(t *testing.T) {
+	render := func(parallel, oversampling int, native, integer, useNext bool) ([]float64, []float64) {
+		chip := sim.NewChip(44100.0, -15.0, -1, nil).
+			SetParallel(parallel).
+			SetOversampling(oversampling).
+			SetNativeRate(native).
+			SetIntegerCore(integer)
+		ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+			Registers: sim.NewRegisters(chip),
+			Library:   &smaf.VM5VoiceLib{},
+		})
+		l := make([]float64, 4096)
+		r := make([]float64, 4096)
+		for block := 0; block < 8; block++ {
+			for i := 0; i < 4; i++ {
+				ctrl.PushMIDIMessage(fmfm.MIDINoteOn, block, i, 48+block*3+i*7, 100)
+			}
+			ctrl.FlushMIDIMessages(block)
+			bl := l[block*512 : (block+1)*512]
+			br := r[block*512 : (block+1)*512]
+			if useNext {
+				for i := range bl {
+					bl[i], br[i] = chip.Next()
+				}
+			} else {
+				chip.Render(bl, br)
+			}
+		}
+		return l, r
+	}
+
+	for _, integer := range []bool{false, true} {
+		for _, native := range []bool{false, true} {
+			for _, oversampling := range []int{1, 2} {
+				expectedL, expectedR := render(1, oversampling, native, integer, true)
+				for _, parallel := range []int{1, 3, 8} {
+					l, r := render(parallel, oversampling, native, integer, false)
+					assert.Equal(t, expectedL, l, "parallel=%d oversampling=%d native=%v integer=%v", parallel, oversampling, native, integer)
+					assert.Equal(t, expectedR, r, "parallel=%d oversampling=%d native=%v integer=%v", parallel, oversampling, native, integer)
+				}
+			}
+		}
+	}
+}
+
+func TestChip_RenderWithSends(t *testing.T) {
+	for _, native := range []bool{false, true} {
+		for _, oversampling := range []int{1, 2} {
+			for _, parallel := range []int{1, 3} {
+				chip := sim.NewChip(44100.0, -15.0, -1, sim.ProfileIdeal).
+					SetParallel(parallel).
+					SetOversampling(oversampling).
+					SetNativeRate(native)
+				ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+					Registers: sim.NewRegisters(chip),
+					Library:   &smaf.VM5VoiceLib{},
+				})
+				for i := 0; i < 4; i++ {
+					ctrl.PushMIDIMessage(fmfm.MIDIControlChange, 0, i, 91, 127)
+					ctrl.PushMIDIMessage(fmfm.MIDIControlChange, 0, i, 93, 0)
+					ctrl.PushMIDIMessage(fmfm.MIDINoteOn, 0, i, 48+i*7, 100)
+				}
+				ctrl.FlushMIDIMessages(0)
+
+				l := make([]float64, 1000)
+				r := make([]float64, 1000)
+				sendL := [][]float64{make([]float64, 1000), make([]float64, 1000)}
+				sendR := [][]float64{make([]float64, 1000), make([]float64, 1000)}
+				chip.Render(l[:300], r[:300])
+				for block := 0; block < 2; block++ {
+					chip.RenderWithSends(l, r, sendL, sendR)
+				}
+				msg := fmt.Sprintf("parallel=%d oversampling=%d native=%v", parallel, oversampling, native)
+				assert.InDeltaSlice(t, l, sendL[sim.SendReverb], 1e-12, msg)
+				assert.InDeltaSlice(t, r, sendR[sim.SendReverb], 1e-12, msg)
+				assert.Equal(t, make([]float64, 1000), sendL[sim.SendChorus], msg)
+			}
+		}
+	}
+}
+
+func TestChip_RenderMIDIChannels(t *testing.T) {
+	for _, oversampling := range []int{1, 2} {
+		chip := sim.NewChip(44100.0, -15.0, -1, sim.ProfileIdeal).SetOversampling(oversampling).SetNativeRate(true)
+		ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+			Registers:       sim.NewRegisters(chip),
+			Library:         &smaf.VM5VoiceLib{},
+			SoloMIDIChannel: -1,
+		})
+		for i := 0; i < 3; i++ {
+			ctrl.PushMIDIMessage(fmfm.MIDINoteOn, 0, i, 48+i*7, 100)
+		}
+		ctrl.FlushMIDIMessages(0)
+
+		l := make([]float64, 1000)
+		r := make([]float64, 1000)
+		busL := make([][]float64, 16)
+		busR := make([][]float64, 16)
+		for m := range busL {
+			busL[m] = make([]float64, 1000)
+			busR[m] = make([]float64, 1000)
+		}
+		chip.RenderMIDIChannels(l, r, busL, busR)
+		for i := range l {
+			assert.InDelta(t, l[i], busL[0][i]+busL[1][i]+busL[2][i], 1e-12)
+			assert.InDelta(t, r[i], busR[0][i]+busR[1][i]+busR[2][i], 1e-12)
+		}
+		assert.NotEqual(t, make([]float64, 1000), busL[1])
+		assert.Equal(t, make([]float64, 1000), busL[3])
+	}
+}
+
+type recordLogger []string
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func TestRegisters_outOfRangeChannel(t *testing.T) {
+	logger := &recordLogger{}
+	chip := sim.NewChip(44100.0, .0, -1, sim.ProfileYMF825).SetLogger(logger)
+	regs := sim.NewRegisters(chip)
+	regs.WriteTL(0, 0, 10, 20)
+	assert.Equal(t, 0, len(*logger))
+
+	regs.WriteChannel(16, ymf.KON, 1)
+	regs.WriteOperator(16, 0, ymf.TL, 0)
+	regs.WriteTL(16, 0, 10, 20)
+	assert.Equal(t, 3, len(*logger))
+	assert.Equal(t, "ignored a write to channel 16: the chip has only 16 channels", (*logger)[0])
+	assert.Equal(t, 0, chip.ActiveChannelCount())
+}
+
+func TestChip_activeChannels(t *testing.T) {
+	chip := sim.NewChip(44100.0, -15.0, -1, nil)
+	ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+		Registers: sim.NewRegisters(chip),
+		Library:   &smaf.VM5VoiceLib{},
+	})
+	assert.Equal(t, 0, chip.ActiveChannelCount())
+
+	for i := 0; i < 4; i++ {
+		ctrl.PushMIDIMessage(fmfm.MIDINoteOn, 0, i, 60, 100)
+	}
+	ctrl.FlushMIDIMessages(0)
+	assert.Equal(t, 4, chip.ActiveChannelCount())
+	for i := 0; i < 4410; i++ {
+		chip.Next()
+	}
+	assert.Equal(t, 4, chip.ActiveChannelCount())
+
+	for i := 0; i < 4; i++ {
+		ctrl.PushMIDIMessage(fmfm.MIDINoteOff, 1, i, 60, 0)
+	}
+	ctrl.FlushMIDIMessages(1)
+	l := make([]float64, 44100)
+	r := make([]float64, 44100)
+	chip.Render(l, r)
+	assert.Equal(t, 0, chip.ActiveChannelCount())
+}
+
+func TestChip_ChannelSnapshots(t *testing.T) {
+	chip := sim.NewChip(44100.0, -15.0, -1, nil)
+	ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+		Registers: sim.NewRegisters(chip),
+		Library:   &smaf.VM5VoiceLib{},
+	})
+	ctrl.PushMIDIMessage(fmfm.MIDINoteOn, 0, 3, 60, 100)
+	ctrl.FlushMIDIMessages(0)
+	for i := 0; i < 100; i++ {
+		chip.Next()
+	}
+
+	snapshots := chip.ChannelSnapshots()
+	assert.Len(t, snapshots, chip.ChannelCount())
+	var active []sim.ChannelSnapshot
+	for _, s := range snapshots {
+		if s.Active {
+			active = append(active, s)
+		}
+	}
+	assert.Len(t, active, 1)
+	s := active[0]
+	assert.Equal(t, 3, s.MIDIChannel)
+	assert.True(t, s.KeyOn)
+	assert.Equal(t, 0, s.Algorithm)
+	assert.True(t, .0 < s.Level)
+	assert.True(t, s.Operators[0].Modulator)
+	assert.False(t, s.Operators[1].Modulator)
+	assert.Equal(t, sim.EnvelopeSustain, s.Operators[1].Stage)
+}
+
+func TestChip_SaveState(t *testing.T) {
+	newChip := func() (*sim.Chip, *fmfm.Controller) {
+		chip := sim.NewChip(44100.0, -15.0, -1, nil).
+			SetOversampling(2).
+			SetNativeRate(true)
+		ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+			Registers: sim.NewRegisters(chip),
+			Library:   &smaf.VM5VoiceLib{},
+		})
+		return chip, ctrl
+	}
+	play := func(chip *sim.Chip, ctrl *fmfm.Controller, from, to int) []float64 {
+		result := []float64{}
+		for block := from; block < to; block++ {
+			ctrl.PushMIDIMessage(fmfm.MIDINoteOn, block, block%3, 48+block*5, 100)
+			ctrl.PushMIDIMessage(fmfm.MIDINoteOff, block, (block+1)%3, 48+(block-2)*5, 0)
+			ctrl.PushMIDIMessage(fmfm.MIDIControlChange, block+1, 0, 10, block*16)
+			ctrl.FlushMIDIMessages(block)
+			for i := 0; i < 1000; i++ {
+				l, _ := chip.Next()
+				result = append(result, l)
+			}
+		}
+		return result
+	}
+
+	chip, ctrl := newChip()
+	play(chip, ctrl, 0, 4)
+	chipState, err := chip.SaveState()
+	assert.NoError(t, err)
+	ctrlState, err := ctrl.SaveState()
+	assert.NoError(t, err)
+	expected := play(chip, ctrl, 4, 8)
+
+	chip, ctrl = newChip()
+	play(chip, ctrl, 0, 1)
+	assert.NoError(t, chip.LoadState(chipState))
+	assert.NoError(t, ctrl.LoadState(ctrlState))
+	assert.Equal(t, expected, play(chip, ctrl, 4, 8))
+
+	assert.Error(t, chip.LoadState(chipState[:len(chipState)/2]))
+	assert.Error(t, ctrl.LoadState(chipState))
+	assert.Error(t, sim.NewChip(48000.0, -15.0, -1, nil).LoadState(chipState))
+
+	// 読み込みに失敗しても、演算中の状態は変わらない
+	chip, ctrl = newChip()
+	play(chip, ctrl, 0, 4)
+	assert.NoError(t, ctrl.LoadState(ctrlState))
+	for _, n := range []int{len(chipState) / 2, len(chipState) - 8} {
+		assert.Error(t, chip.LoadState(chipState[:n]))
+	}
+	assert.Equal(t, expected, play(chip, ctrl, 4, 8))
+}
+
+func BenchmarkChip_Next(b *testing.B) {
+	for _, voices := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("voices=%d", voices), func(b *testing.B) {
+			benchmarkChipNext(b, voices)
+		})
+	}
+}
+
+func benchmarkChipNext(b *testing.B, voices int) {
+	chip := sim.NewChip(44100.0, -15.0, -1, nil)
+	ctrl := fmfm.NewController(&fmfm.ControllerOpts{
+		Registers: sim.NewRegisters(chip),
+		Library:   &smaf.VM5VoiceLib{},
+	})
+	for i := 0; i < voices; i++ {
+		ctrl.PushMIDIMessage(fmfm.MIDINoteOn, 0, i%16, 48+i, 100)
+	}
+	ctrl.FlushMIDIMessages(0)
+	if chip.ActiveChannelCount() != voices {
+		b.Fatalf("active channels: %d", chip.ActiveChannelCount())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chip.Next()
+	}
+}
@@ -0,0 +1,69 @@
+package sim
+
+import (
+	"math"
+)
+
+// decimatorTapsPerPhase は、デシメーションフィルタの各位相あたりのタップ数です。
+const decimatorTapsPerPhase = 32
+
+// decimator は、オーバーサンプリングされた信号を 1/factor に間引くポリフェーズFIRフィルタです。
+type decimator struct {
+	factor int
+	// phases は、フィルタ係数 h[k*factor+p] を位相 p ごとに分けたものです。
+	phases [][]float64
+	// history は、位相ごとの入力履歴のリングバッファです。
+	history [][]float64
+	pos     int
+}
+
+func newDecimator(factor int) *decimator {
+	d := &decimator{
+		factor:  factor,
+		phases:  make([][]float64, factor),
+		history: make([][]float64, factor),
+	}
+
+	// ブラックマン窓をかけた sinc 関数で、出力のナイキスト周波数の 0.9 倍以下を通過させる
+	n := factor * decimatorTapsPerPhase
+	cutoff := .45 / float64(factor)
+	h := make([]float64, n)
+	sum := .0
+	for i := range h {
+		x := float64(i) - float64(n-1)*.5
+		sinc := 2.0 * cutoff
+		if x != .0 {
+			sinc = math.Sin(2.0*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		a := 2.0 * math.Pi * float64(i) / float64(n-1)
+		window := .42 - .5*math.Cos(a) + .08*math.Cos(2.0*a)
+		h[i] = sinc * window
+		sum += h[i]
+	}
+
+	for p := 0; p < factor; p++ {
+		d.phases[p] = make([]float64, decimatorTapsPerPhase)
+		d.history[p] = make([]float64, decimatorTapsPerPhase)
+		for k := 0; k < decimatorTapsPerPhase; k++ {
+			d.phases[p][k] = h[k*factor+p] / sum
+		}
+	}
+	return d
+}
+
+// next は、時系列順に並んだ factor 個の入力サンプルから、1個の出力サンプルを返します。
+func (d *decimator) next(in []float64) float64 {
+	d.pos = (d.pos + decimatorTapsPerPhase - 1) % decimatorTapsPerPhase
+	for p := 0; p < d.factor; p++ {
+		d.history[p][d.pos] = in[d.factor-1-p]
+	}
+
+	result := .0
+	for p, coefs := range d.phases {
+		history := d.history[p]
+		for k, c := range coefs {
+			result += c * history[(d.pos+k)%decimatorTapsPerPhase]
+		}
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecimator(t *testing.T) {
+	// 出力のサンプルレートに対する周波数比ごとの振幅
+	measure := func(factor int, freq float64) float64 {
+		d := newDecimator(factor)
+		in := make([]float64, factor)
+		power := .0
+		for n := 0; n < 2000; n++ {
+			for j := range in {
+				x := float64(n*factor+j) / float64(factor)
+				in[j] = math.Cos(2.0 * math.Pi * freq * x)
+			}
+			v := d.next(in)
+			if 1000 <= n {
+				power += v * v
+			}
+		}
+		// 正弦波の実効値から振幅を求める
+		if freq == .0 {
+			return math.Sqrt(power / 1000.0)
+		}
+		return math.Sqrt(power / 1000.0 * 2.0)
+	}
+
+	for _, factor := range []int{2, 4} {
+		assert.InDelta(t, 1.0, measure(factor, .0), .001, "factor=%d DC", factor)
+		assert.InDelta(t, 1.0, measure(factor, .1), .01, "factor=%d passband", factor)
+		stopband := 20.0 * math.Log10(measure(factor, .75))
+		assert.True(t, stopband < -40.0, "factor=%d stopband=%fdB", factor, stopband)
+	}
+}
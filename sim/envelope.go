@@ -2,6 +2,7 @@ package sim
 
 import (
 	"math"
+	"math/bits"
 
 	"github.com/but80/fmfm.core/ymf/ymfdata"
 )
@@ -47,18 +48,43 @@ type envelopeGenerator struct {
 	kslCoef         float64
 	tlCoef          float64
 	kslTlCoef       float64
+	kslSteps        int
+	tlSteps         int
+	kslTlSteps      int
 	sustainLevel    float64
 	currentLevel    float64
+	// 以下は、整数コアのエンベロープカウンタの状態とパラメータです。
+	// attenuation は、エンベロープ減衰量のステップ数です。
+	attenuation int
+	// keyOnPending は、キーオン直後の最初のクロックを待っているかどうかです。
+	keyOnPending bool
+	ar           int
+	dr           int
+	sr           int
+	rr           int
+	// ks は、キースケーリングによりレートに加算する値です。
+	ks int
+	// sustainSteps は、減衰量の上位5bitと比較するサステインレベルです。
+	sustainSteps int
+
+	tremoloTable     *[4][ymfdata.ModTableLen]float64
+	tremoloStepTable *[4][ymfdata.ModTableLen]int
 }
 
 func newEnvelopeGenerator(sampleRate float64) *envelopeGenerator {
-	eg := &envelopeGenerator{sampleRate: sampleRate}
+	eg := &envelopeGenerator{
+		sampleRate:       sampleRate,
+		tremoloTable:     &ymfdata.TremoloTable,
+		tremoloStepTable: &ymfdata.TremoloStepTable,
+	}
 	eg.resetAll()
 	return eg
 }
 
 func (eg *envelopeGenerator) reset() {
 	eg.currentLevel = .0
+	eg.attenuation = ymfdata.EnvelopeStepMax
+	eg.keyOnPending = false
 	eg.stage = stageOff
 }
 
@@ -72,7 +98,9 @@ func (eg *envelopeGenerator) resetAll() {
 }
 
 func (eg *envelopeGenerator) setActualSustainLevel(sl int) {
+	eg.sustainSteps = sl
 	if sl == 0x0f {
+		eg.sustainSteps = 0x1f
 		eg.sustainLevel = 0
 	} else {
 		slDB := -3.0 * float64(sl)
@@ -81,6 +109,9 @@ func (eg *envelopeGenerator) setActualSustainLevel(sl int) {
 }
 
 func (eg *envelopeGenerator) setTotalLevel(tl int) {
+	// 整数コアでは、TL=63 も無音ではなく -47.25dB として扱う
+	eg.tlSteps = tl << 2
+	eg.kslTlSteps = eg.kslSteps + eg.tlSteps
 	if 63 <= tl {
 		eg.tlCoef = .0
 		eg.kslTlCoef = .0
@@ -91,6 +122,9 @@ func (eg *envelopeGenerator) setTotalLevel(tl int) {
 	eg.kslTlCoef = eg.kslCoef * eg.tlCoef
 }
 
+// kslShift は、KSLパラメータごとに、KSLTableROM から得た減衰量を右シフトするビット数です。
+var kslShift = [4]uint{8, 1, 2, 0}
+
 func (eg *envelopeGenerator) setKeyScalingLevel(fnum, block, bo, ksl int) {
 	blkbo := block + 1 - bo
 	if blkbo < 0 {
@@ -100,9 +134,20 @@ func (eg *envelopeGenerator) setKeyScalingLevel(fnum, block, bo, ksl int) {
 	}
 	eg.kslCoef = ymfdata.KSLTable[ksl][blkbo][fnum>>5]
 	eg.kslTlCoef = eg.kslCoef * eg.tlCoef
+	steps := ymfdata.KSLTableROM[fnum>>6]<<2 - (8-blkbo)<<5
+	if steps < 0 {
+		steps = 0
+	}
+	eg.kslSteps = steps >> kslShift[ksl]
+	eg.kslTlSteps = eg.kslSteps + eg.tlSteps
 }
 
 func (eg *envelopeGenerator) setActualAR(attackRate, ksr, keyScaleNumber int) {
+	eg.ar = attackRate
+	eg.ks = keyScaleNumber >> 2
+	if ksr != 0 {
+		eg.ks = keyScaleNumber
+	}
 	if attackRate <= 0 {
 		eg.arDiffPerSample = .0
 		return
@@ -113,6 +158,7 @@ func (eg *envelopeGenerator) setActualAR(attackRate, ksr, keyScaleNumber int) {
 }
 
 func (eg *envelopeGenerator) setActualDR(dr, ksr, keyScaleNumber int) {
+	eg.dr = dr
 	if dr == 0 {
 		eg.drCoefPerSample = 1.0
 	} else {
@@ -123,6 +169,7 @@ func (eg *envelopeGenerator) setActualDR(dr, ksr, keyScaleNumber int) {
 }
 
 func (eg *envelopeGenerator) setActualSR(sr, ksr, keyScaleNumber int) {
+	eg.sr = sr
 	if sr == 0 {
 		eg.srCoefPerSample = 1.0
 	} else {
@@ -133,6 +180,7 @@ func (eg *envelopeGenerator) setActualSR(sr, ksr, keyScaleNumber int) {
 }
 
 func (eg *envelopeGenerator) setActualRR(rr, ksr, keyScaleNumber int) {
+	eg.rr = rr
 	if rr == 0 {
 		eg.rrCoefPerSample = 1.0
 	} else {
@@ -142,7 +190,7 @@ func (eg *envelopeGenerator) setActualRR(rr, ksr, keyScaleNumber int) {
 	}
 }
 
-func (eg *envelopeGenerator) getEnvelope(tremoloIndex int) float64 {
+func (eg *envelopeGenerator) advance() {
 	switch eg.stage {
 
 	case stageAttack:
@@ -177,15 +225,163 @@ func (eg *envelopeGenerator) getEnvelope(tremoloIndex int) float64 {
 			eg.stage = stageOff
 		}
 	}
+}
 
+func (eg *envelopeGenerator) getEnvelope(tremoloIndex int) float64 {
+	eg.advance()
 	result := eg.currentLevel
 	if eg.eam {
-		result *= ymfdata.TremoloTable[eg.dam][tremoloIndex]
+		result *= eg.tremoloTable[eg.dam][tremoloIndex]
 	}
 	return result * eg.kslTlCoef
 }
 
+// getSteps は、現在の減衰量をエンベロープのステップ数で返した後、
+// 整数コアのエンベロープカウンタを [from, to) の範囲のクロック分進めます。
+func (eg *envelopeGenerator) getSteps(tremoloIndex int, from, to uint64) int {
+	result := eg.attenuation + eg.kslTlSteps
+	if eg.eam {
+		result += eg.tremoloStepTable[eg.dam][tremoloIndex]
+	}
+	for t := from; t < to; t++ {
+		eg.clock(egClockAt(t))
+	}
+	if ymfdata.EnvelopeStepMax < result {
+		return ymfdata.EnvelopeStepMax
+	}
+	return result
+}
+
+// egIncStep は、レートの下位2bitと共通タイマーの下位2bitに対する、高いレートでの増分のシフト量です。
+var egIncStep = [4][4]int{
+	{0, 0, 0, 0},
+	{1, 0, 0, 0},
+	{1, 0, 1, 0},
+	{1, 1, 1, 0},
+}
+
+// egClock は、全オペレータ共通のエンベロープのタイマーの、あるクロックにおける状態です。
+type egClock struct {
+	// state は、クロックの偶奇です。
+	state int
+	// add は、タイマーの値の末尾の0のビット数に1を加えた値です。12を超える場合は0です。
+	add int
+	// timerLo は、タイマーの下位2bitです。
+	timerLo int
+}
+
+// egClockAt は、チップ固有のサンプルレートで数えたクロック t における egClock を返します。
+// タイマーは奇数番目のクロックごとに1増え、その直前の値が次の2クロックの更新周期を決めます。
+func egClockAt(t uint64) egClock {
+	c := egClock{state: int(t & 1)}
+	if t < 2 {
+		return c
+	}
+	timer := (t - 1 - uint64(c.state)) >> 1
+	if timer == 0 {
+		return c
+	}
+	if n := bits.TrailingZeros64(timer); n <= 12 {
+		c.add = n + 1
+	}
+	c.timerLo = int(timer & 3)
+	return c
+}
+
+// clock は、整数コアのエンベロープカウンタを1クロック進めます。
+func (eg *envelopeGenerator) clock(c egClock) {
+	var reg int
+	switch {
+	case eg.keyOnPending:
+		reg = eg.ar
+	case eg.stage == stageAttack:
+		reg = eg.ar
+	case eg.stage == stageDecay:
+		reg = eg.dr
+	case eg.stage == stageSustain:
+		reg = eg.sr
+	case eg.stage == stageRelease:
+		reg = eg.rr
+	default:
+		return
+	}
+
+	rate := eg.ks + reg<<2
+	rateHi, rateLo := rate>>2, rate&3
+	if 15 < rateHi {
+		rateHi = 15
+	}
+	shift := 0
+	if reg != 0 {
+		if rateHi < 12 {
+			if c.state != 0 {
+				switch rateHi + c.add {
+				case 12:
+					shift = 1
+				case 13:
+					shift = rateLo >> 1 & 1
+				case 14:
+					shift = rateLo & 1
+				}
+			}
+		} else {
+			shift = rateHi&3 + egIncStep[rateLo][c.timerLo]
+			if shift&4 != 0 {
+				shift = 3
+			}
+			if shift == 0 {
+				shift = c.state
+			}
+		}
+	}
+
+	if eg.keyOnPending {
+		// キーオン直後のクロックでは減衰量を進めず、AR=15 の場合のみ即座に最大音量にする
+		eg.keyOnPending = false
+		if reg != 0 && rateHi == 15 {
+			eg.attenuation = 0
+			eg.currentLevel = 1.0
+		}
+		return
+	}
+
+	att := eg.attenuation
+	off := att&0x1f8 == 0x1f8
+	inc := 0
+	switch eg.stage {
+	case stageAttack:
+		if att == 0 {
+			eg.stage = stageDecay
+		} else if 0 < shift && rateHi != 15 {
+			inc = ^att >> uint(4-shift)
+		}
+	case stageDecay:
+		if att>>4 == eg.sustainSteps {
+			eg.stage = stageSustain
+		} else if !off && 0 < shift {
+			inc = 1 << uint(shift-1)
+		}
+	default:
+		if !off && 0 < shift {
+			inc = 1 << uint(shift-1)
+		}
+	}
+	if eg.stage != stageAttack && off {
+		att = ymfdata.EnvelopeStepMax
+	}
+	eg.attenuation = (att + inc) & ymfdata.EnvelopeStepMax
+	// ダンプ表示やスナップショットのため、浮動小数点数のレベルにも反映する
+	eg.currentLevel = float64(ymfdata.LogToLinear(eg.attenuation<<ymfdata.EnvelopeStepShift)) / float64(ymfdata.LogToLinear(0))
+	if eg.attenuation == ymfdata.EnvelopeStepMax && (eg.stage == stageSustain || eg.stage == stageRelease) {
+		eg.stage = stageOff
+	}
+}
+
 func (eg *envelopeGenerator) keyOn() {
+	// 整数コアのエンベロープカウンタは、消音中からのキーオンでのみ初期化する
+	if eg.stage == stageOff || eg.stage == stageRelease {
+		eg.keyOnPending = true
+	}
 	eg.stage = stageAttack
 }
 
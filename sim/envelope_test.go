@@ -57,3 +57,61 @@ func TestEnvelopeGenerator(t *testing.T) {
 		{17, 22, 22, 31, 31, 44, 44, 62, 62, 89, 89, 125, 125, 179, 179, 250},
 	}, result)
 }
+
+func TestEgClockAt(t *testing.T) {
+	assert.Equal(t, egClock{state: 0}, egClockAt(0))
+	assert.Equal(t, egClock{state: 1}, egClockAt(3))
+	assert.Equal(t, egClock{state: 0, add: 1, timerLo: 1}, egClockAt(4))
+	assert.Equal(t, egClock{state: 1, add: 2, timerLo: 2}, egClockAt(7))
+	assert.Equal(t, egClock{state: 0, add: 12, timerLo: 0}, egClockAt(4098))
+	// 末尾の0が12bitを超える場合は更新しない
+	assert.Equal(t, egClock{state: 0, add: 0, timerLo: 0}, egClockAt(16386))
+}
+
+func TestEnvelopeGenerator_clock(t *testing.T) {
+	gen := newEnvelopeGenerator(ymfdata.SampleRate)
+	gen.setActualAR(13, 0, 0)
+	gen.setActualDR(15, 0, 0)
+	gen.setActualSustainLevel(2)
+	gen.setActualRR(15, 0, 0)
+
+	// アタックは減衰量の1の補数を右シフトした値ずつ0に近づく
+	gen.keyOn()
+	gen.clock(egClockAt(0))
+	assert.Equal(t, 511, gen.attenuation)
+	gen.clock(egClockAt(1))
+	assert.Equal(t, 447, gen.attenuation)
+	gen.clock(egClockAt(2))
+	assert.Equal(t, 391, gen.attenuation)
+
+	// DR=15 は1クロックあたり4ステップ減衰し、サステインレベルで止まる
+	gen.attenuation = 0
+	gen.clock(egClockAt(3))
+	assert.Equal(t, stageDecay, gen.stage)
+	for i := uint64(4); i < 12; i++ {
+		gen.clock(egClockAt(i))
+	}
+	assert.Equal(t, 32, gen.attenuation)
+	gen.clock(egClockAt(12))
+	assert.Equal(t, stageSustain, gen.stage)
+	assert.Equal(t, 32, gen.attenuation)
+
+	// 減衰量の上位6bitがすべて1になると、次のクロックで消音する
+	gen.keyOff()
+	gen.attenuation = 500
+	gen.clock(egClockAt(13))
+	assert.Equal(t, 504, gen.attenuation)
+	gen.clock(egClockAt(14))
+	assert.Equal(t, 511, gen.attenuation)
+	assert.Equal(t, stageOff, gen.stage)
+
+	// DR=1 は4096クロックに1ステップ減衰する
+	gen.setActualDR(1, 0, 0)
+	gen.setActualSustainLevel(15)
+	gen.stage = stageDecay
+	gen.attenuation = 0
+	for i := uint64(2); i < 3*4096; i++ {
+		gen.clock(egClockAt(i))
+	}
+	assert.Equal(t, 3, gen.attenuation)
+}
@@ -22,6 +22,8 @@ type operator struct {
 	rr             int
 	xof            int
 	ws             int
+	fb             int
+	waveform       []float64
 	feedbackCoef   float64
 	keyScaleNumber int
 	fnum           int
@@ -37,15 +39,27 @@ type operator struct {
 }
 
 func newOperator(channelID, operatorIndex int, chip *Chip) *operator {
-	return &operator{
+	op := &operator{
 		chip:              chip,
 		channelID:         channelID,
 		operatorIndex:     operatorIndex,
-		phaseGenerator:    newPhaseGenerator(chip.sampleRate),
-		envelopeGenerator: newEnvelopeGenerator(chip.sampleRate),
+		phaseGenerator:    newPhaseGenerator(chip.coreSampleRate),
+		envelopeGenerator: newEnvelopeGenerator(chip.coreSampleRate),
 		isModulator:       false,
 		bo:                1,
 	}
+	op.phaseGenerator.vibratoTable = chip.tables.vibratoTable
+	op.envelopeGenerator.tremoloTable = chip.tables.tremoloTable
+	op.envelopeGenerator.tremoloStepTable = chip.tables.tremoloStepTable
+	op.updateWaveform()
+	return op
+}
+
+func (op *operator) setSampleRate(sampleRate float64) {
+	op.phaseGenerator.sampleRate = sampleRate
+	op.envelopeGenerator.sampleRate = sampleRate
+	op.updateFrequency()
+	op.updateEnvelope()
 }
 
 func (op *operator) reset() {
@@ -198,9 +212,22 @@ func (op *operator) setXOF(v int) {
 
 func (op *operator) setWS(v int) {
 	op.ws = v
+	op.updateWaveform()
+}
+
+// updateWaveform は、波形選択と周波数から使用する波形テーブルを選択します。
+// 帯域制限モードでは、折り返しを生じない倍音数の範囲で最も倍音の多いテーブルを選択します。
+func (op *operator) updateWaveform() {
+	if !op.chip.bandLimited {
+		op.waveform = ymfdata.Waveforms[op.ws]
+		return
+	}
+	level := ymfdata.BandLimitedLevel(op.phaseGenerator.phaseIncrementFrac64)
+	op.waveform = ymfdata.BandLimitedWaveforms()[op.ws][level]
 }
 
 func (op *operator) setFB(v int) {
+	op.fb = v
 	op.feedbackCoef = ymfdata.FeedbackTable[v]
 }
 
@@ -213,7 +240,28 @@ func (op *operator) next(modIndex int, modulator float64) float64 {
 
 	sampleIndex := uint64(phaseFrac64) >> ymfdata.WaveformIndexShift
 	sampleIndex += uint64((modulator + ymfdata.WaveformLen) * ymfdata.WaveformLen)
-	return ymfdata.Waveforms[op.ws][sampleIndex&1023] * envelope
+	return op.waveform[sampleIndex&1023] * envelope
+}
+
+// nextInt は、対数サインテーブル、指数テーブルおよび整数のエンベロープカウンタを用いて、
+// 次のサンプルを整数の振幅で返します。
+// modulator は、モジュレータの出力をそのまま10bitの位相に加算する値です。
+// エンベロープは、チップ固有のサンプルレートで数えたクロック [egFrom, egTo) の分だけ進めます。
+func (op *operator) nextInt(modIndex int, modulator int32, egFrom, egTo uint64) int32 {
+	phaseFrac64 := op.phaseGenerator.getPhase(modIndex)
+	if op.envelopeGenerator.stage == stageOff {
+		return 0
+	}
+	steps := op.envelopeGenerator.getSteps(modIndex, egFrom, egTo)
+
+	sampleIndex := int32(uint64(phaseFrac64)>>ymfdata.WaveformIndexShift) + modulator
+	w := ymfdata.LogWaveforms[op.ws][sampleIndex&1023]
+	v := ymfdata.LogToLinear(int(w&^ymfdata.LogSignBit) + steps<<ymfdata.EnvelopeStepShift)
+	// 負の値は1の補数で表す
+	if w&ymfdata.LogSignBit != 0 {
+		return ^v
+	}
+	return v
 }
 
 func (op *operator) keyOn() {
@@ -221,6 +269,7 @@ func (op *operator) keyOn() {
 		op.envelopeGenerator.keyOn()
 	} else {
 		op.envelopeGenerator.stage = stageOff
+		op.envelopeGenerator.attenuation = ymfdata.EnvelopeStepMax
 	}
 }
 
@@ -248,6 +297,7 @@ func (op *operator) setFrequency(fnum, blk, bo int) {
 
 func (op *operator) updateFrequency() {
 	op.phaseGenerator.setFrequency(op.fnum, op.block, op.bo, op.mult, op.dt)
+	op.updateWaveform()
 }
 
 func (op *operator) updateEnvelope() {
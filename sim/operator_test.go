@@ -0,0 +1,73 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperator_nextInt(t *testing.T) {
+	chip := NewChip(ymfdata.SampleRate, .0, -1, nil)
+	op := newOperator(0, 0, chip)
+	op.setMULT(1)
+	op.setAR(15)
+	op.setSL(0)
+	op.setTL(0)
+	// 位相を進めず、モジュレータの値をそのまま位相として与える
+	op.setFrequency(0, 0, 1)
+	op.keyOn()
+
+	// キーオン直後のクロックで AR=15 により減衰量が0になる
+	assert.Equal(t, int32(0), op.nextInt(0, 0x100, 0, 1))
+	assert.Equal(t, 0, op.envelopeGenerator.attenuation)
+
+	cases := []struct {
+		ws       int
+		phase    int32
+		expected int32
+	}{
+		{0, 0x100, 4084},
+		{0, 0x300, -4085},
+		{0, 0x000, 12},
+		{0, 0x200, -13},
+		{0, 0x080, 2896},
+		{1, 0x300, 0},
+		{6, 0x000, 4084},
+		{6, 0x200, -4085},
+		{7, 0x001, 3998},
+	}
+	for _, c := range cases {
+		op.setWS(c.ws)
+		assert.Equal(t, c.expected, op.nextInt(0, c.phase, 1, 1), "ws=%d phase=%#x", c.ws, c.phase)
+	}
+
+	// TL=32 (-24dB) は減衰量128ステップで、振幅は1/16になる
+	op.setWS(0)
+	op.setTL(32)
+	assert.Equal(t, int32(255), op.nextInt(0, 0x100, 1, 1))
+}
+
+func TestOperator_bandLimited(t *testing.T) {
+	chip := NewChip(ymfdata.SampleRate, .0, -1, nil)
+	op := chip.channels[0].operators[0]
+	op.setWS(16)
+	op.setMULT(1)
+	op.setFrequency(300, 6, 1)
+	assert.Equal(t, &ymfdata.Waveforms[16][0], &op.waveform[0])
+
+	chip.SetBandLimited(true)
+	low := ymfdata.BandLimitedLevel(op.phaseGenerator.phaseIncrementFrac64)
+	assert.Equal(t, &ymfdata.BandLimitedWaveforms()[16][low][0], &op.waveform[0])
+
+	// 周波数が高いほど倍音の少ないテーブルが選択される
+	op.setFrequency(300, 7, 1)
+	high := ymfdata.BandLimitedLevel(op.phaseGenerator.phaseIncrementFrac64)
+	assert.Equal(t, low+1, high)
+	assert.Equal(t, &ymfdata.BandLimitedWaveforms()[16][high][0], &op.waveform[0])
+
+	// 倍音を制限しない段は元の波形と一致する
+	for i, v := range ymfdata.BandLimitedWaveforms()[0][0] {
+		assert.InDelta(t, ymfdata.Waveforms[0][i], v, 1e-9)
+	}
+}
@@ -10,10 +10,14 @@ type phaseGenerator struct {
 	dvb                  int
 	phaseFrac64          ymfdata.Frac64
 	phaseIncrementFrac64 ymfdata.Frac64
+	vibratoTable         *[4][ymfdata.ModTableLen]ymfdata.Int32Frac32
 }
 
 func newPhaseGenerator(sampleRate float64) *phaseGenerator {
-	pg := &phaseGenerator{sampleRate: sampleRate}
+	pg := &phaseGenerator{
+		sampleRate:   sampleRate,
+		vibratoTable: &ymfdata.VibratoTableInt32Frac32,
+	}
 	pg.reset()
 	return pg
 }
@@ -44,7 +48,7 @@ func (pg *phaseGenerator) setFrequency(fnum, block, bo, mult, dt int) {
 
 func (pg *phaseGenerator) getPhase(vibratoIndex int) ymfdata.Frac64 {
 	if pg.evb {
-		pg.phaseFrac64 += pg.phaseIncrementFrac64.MulInt32Frac32(ymfdata.VibratoTableInt32Frac32[pg.dvb][vibratoIndex])
+		pg.phaseFrac64 += pg.phaseIncrementFrac64.MulInt32Frac32(pg.vibratoTable[pg.dvb][vibratoIndex])
 	} else {
 		pg.phaseFrac64 += pg.phaseIncrementFrac64
 	}
@@ -0,0 +1,226 @@
+package sim
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+)
+
+// PanLaw は、パンによる左右の振幅の配分方法を表す列挙子型です。
+type PanLaw int
+
+const (
+	// PanLawConstantPower は、左右の振幅を余弦・正弦で配分する等パワーのパン則です。
+	PanLawConstantPower PanLaw = iota
+	// PanLawLinear は、左右の振幅を線形に配分するパン則です。
+	PanLawLinear
+	// PanLawMono は、パンを無視して左右に同じ振幅を出力するパン則です。
+	PanLawMono
+)
+
+// PanBlend は、チャンネルパン（CHPAN）とボイスパン（PANPOT）の合成方法を表す列挙子型です。
+type PanBlend int
+
+const (
+	// PanBlendAdd は、ボイスパンをチャンネルパンに加算してからパン則を適用します。
+	PanBlendAdd PanBlend = iota
+	// PanBlendMultiply は、それぞれにパン則を適用した係数を乗算します。
+	PanBlendMultiply
+)
+
+// LFOShape は、ビブラートおよびトレモロのLFO波形を表す列挙子型です。
+type LFOShape int
+
+const (
+	// LFOShapeTriangle は、三角波のLFOです。
+	LFOShapeTriangle LFOShape = iota
+	// LFOShapeSine は、正弦波のLFOです。
+	LFOShapeSine
+)
+
+// Profile は、エミュレーション対象のチップごとに異なる特性をまとめた型です。
+type Profile struct {
+	// Name は、プロファイルの名前です。
+	Name string
+	// ChannelCount は、チップが備えるチャンネル数です。
+	ChannelCount int
+	// PanLaw は、パン則です。
+	PanLaw PanLaw
+	// PanResolution は、パンの段階数です。0 の場合は MIDI の 128 段階をそのまま使用します。
+	PanResolution int
+	// PanBlend は、チャンネルパンとボイスパンの合成方法です。
+	PanBlend PanBlend
+	// LFOShape は、LFOの波形です。
+	LFOShape LFOShape
+	// LFOResolution は、LFOの1周期あたりの段階数です。0 の場合は量子化しません。
+	LFOResolution int
+	// VibratoDepth は、DVBパラメータによるビブラートの深さ[cent]です。
+	VibratoDepth [4]float64
+	// TremoloDepth は、DAMパラメータによるトレモロの深さ[dB]です。
+	TremoloDepth [4]float64
+	// OutputBits は、出力の量子化ビット数です。0 の場合は量子化しません。
+	OutputBits int
+}
+
+// ProfileMA5 は、YAMAHA MA-5 (YMU765) を模したプロファイルです。
+// TODO: ATS-MA5 の出力を解析して DVB 波形、ビブラートとパンの分解能、パンの合成方法を確定する
+var ProfileMA5 = &Profile{
+	Name:          "ma5",
+	ChannelCount:  32,
+	PanLaw:        PanLawConstantPower,
+	PanResolution: 0,
+	PanBlend:      PanBlendAdd,
+	LFOShape:      LFOShapeTriangle,
+	LFOResolution: 0,
+	VibratoDepth:  ymfdata.VibratoDepth,
+	TremoloDepth:  ymfdata.TremoloDepth,
+	OutputBits:    0,
+}
+
+// ProfileYMF825 は、YAMAHA YMF825 を模したプロファイルです。
+// YMF825 はモノラル出力で、16チャンネルを備えます。
+var ProfileYMF825 = &Profile{
+	Name:          "ymf825",
+	ChannelCount:  16,
+	PanLaw:        PanLawMono,
+	PanResolution: 0,
+	PanBlend:      PanBlendAdd,
+	LFOShape:      LFOShapeTriangle,
+	LFOResolution: 64,
+	VibratoDepth:  ymfdata.VibratoDepth,
+	TremoloDepth:  ymfdata.TremoloDepth,
+	OutputBits:    16,
+}
+
+// ProfileIdeal は、実機の制約にとらわれない高品位なプロファイルです。
+var ProfileIdeal = &Profile{
+	Name:          "ideal",
+	ChannelCount:  ymfdata.ChannelCount,
+	PanLaw:        PanLawConstantPower,
+	PanResolution: 0,
+	PanBlend:      PanBlendMultiply,
+	LFOShape:      LFOShapeSine,
+	LFOResolution: 0,
+	VibratoDepth:  ymfdata.VibratoDepth,
+	TremoloDepth:  ymfdata.TremoloDepth,
+	OutputBits:    0,
+}
+
+// Profiles は、組み込みのプロファイルの一覧です。
+var Profiles = []*Profile{ProfileMA5, ProfileYMF825, ProfileIdeal}
+
+// FindProfile は、名前に一致する組み込みのプロファイルを返します。
+func FindProfile(name string) (*Profile, bool) {
+	for _, p := range Profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// profileTables は、プロファイルから生成されるテーブルです。
+type profileTables struct {
+	panTable         [128][2]float64
+	vibratoTable     *[4][ymfdata.ModTableLen]ymfdata.Int32Frac32
+	tremoloTable     *[4][ymfdata.ModTableLen]float64
+	tremoloStepTable *[4][ymfdata.ModTableLen]int
+	outputScale      float64
+}
+
+var (
+	profileTablesMutex sync.Mutex
+	profileTablesCache = map[Profile]*profileTables{}
+)
+
+// tables は、プロファイルから生成されるテーブルを返します。
+// 同じ内容のプロファイルに対しては、生成済みのテーブルを共有します。
+func (p *Profile) tables() *profileTables {
+	profileTablesMutex.Lock()
+	defer profileTablesMutex.Unlock()
+	if t, ok := profileTablesCache[*p]; ok {
+		return t
+	}
+	t := p.newTables()
+	profileTablesCache[*p] = t
+	return t
+}
+
+func (p *Profile) newTables() *profileTables {
+	t := &profileTables{}
+
+	// generate pan table
+	for i := 0; i < 128; i++ {
+		x := float64(i) / 127.0
+		switch p.PanLaw {
+		case PanLawLinear:
+			t.panTable[i][0] = 1.0 - x
+			t.panTable[i][1] = x
+		case PanLawMono:
+			t.panTable[i][0] = math.Sqrt2 * .5
+			t.panTable[i][1] = math.Sqrt2 * .5
+		default:
+			a := math.Pi * .5 * float64(i) / 127.0
+			t.panTable[i][0] = math.Cos(a)
+			t.panTable[i][1] = math.Sin(a)
+		}
+	}
+
+	// generate LFO tables
+	vibratoWave, tremoloWave := ymfdata.TriSin, ymfdata.TriCos
+	if p.LFOShape == LFOShapeSine {
+		vibratoWave = func(phase float64) float64 { return math.Sin(2.0 * math.Pi * phase) }
+		tremoloWave = func(phase float64) float64 { return math.Cos(2.0 * math.Pi * phase) }
+	}
+	t.vibratoTable = ymfdata.GenerateVibratoTable(p.VibratoDepth, vibratoWave, p.LFOResolution)
+	t.tremoloTable = ymfdata.GenerateTremoloTable(p.TremoloDepth, tremoloWave, p.LFOResolution)
+	t.tremoloStepTable = ymfdata.GenerateTremoloStepTable(t.tremoloTable)
+
+	if 0 < p.OutputBits {
+		t.outputScale = float64(uint64(1) << uint(p.OutputBits-1))
+	}
+	return t
+}
+
+// quantizePan は、0..127 のパンをプロファイルの分解能に量子化します。
+func (p *Profile) quantizePan(pan int) int {
+	if pan < 0 {
+		pan = 0
+	} else if 127 < pan {
+		pan = 127
+	}
+	if p.PanResolution <= 1 || 128 <= p.PanResolution {
+		return pan
+	}
+	n := p.PanResolution - 1
+	return int(math.Floor(float64(pan*n)/127.0+.5)) * 127 / n
+}
+
+// panCoef は、チャンネルパンとボイスパンから左右それぞれの振幅にかかる係数を返します。
+func (t *profileTables) panCoef(p *Profile, chpan, panpot int) (float64, float64) {
+	if p.PanBlend == PanBlendMultiply {
+		c := t.panTable[p.quantizePan(chpan)]
+		v := t.panTable[p.quantizePan(64+(panpot-15)*4)]
+		center := t.panTable[64]
+		return c[0] * v[0] / center[0], c[1] * v[1] / center[1]
+	}
+	pan := t.panTable[p.quantizePan(chpan+(panpot-15)*4)]
+	return pan[0], pan[1]
+}
+
+// quantizeOutput は、出力をプロファイルのビット数に量子化します。
+func (t *profileTables) quantizeOutput(v float64) float64 {
+	if t.outputScale == .0 {
+		return v
+	}
+	v = math.Floor(v*t.outputScale+.5) / t.outputScale
+	max := (t.outputScale - 1.0) / t.outputScale
+	if v < -1.0 {
+		return -1.0
+	} else if max < v {
+		return max
+	}
+	return v
+}
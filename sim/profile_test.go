@@ -0,0 +1,26 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfile_panCoef(t *testing.T) {
+	ma5 := ProfileMA5.tables()
+	for pan := 0; pan < 128; pan++ {
+		l, r := ma5.panCoef(ProfileMA5, pan, 15)
+		assert.Equal(t, ymfdata.PanTable[pan][0], l)
+		assert.Equal(t, ymfdata.PanTable[pan][1], r)
+	}
+
+	ymf825 := ProfileYMF825.tables()
+	l, r := ymf825.panCoef(ProfileYMF825, 0, 0)
+	assert.Equal(t, l, r)
+
+	p := *ProfileMA5
+	p.PanResolution = 2
+	assert.Equal(t, 0, p.quantizePan(63))
+	assert.Equal(t, 127, p.quantizePan(64))
+}
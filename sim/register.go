@@ -18,10 +18,23 @@ func NewRegisters(chip *Chip) *Registers {
 	}
 }
 
+// validChannel は、チャンネル番号 channel が音源チップの備えるチャンネルの範囲内かどうかを返します。
+// 範囲外の場合は、書き込みを無視することをロガーに出力します。
+func (regs *Registers) validChannel(channel int) bool {
+	if 0 <= channel && channel < len(regs.chip.channels) {
+		return true
+	}
+	regs.chip.logger.Printf("ignored a write to channel %d: the chip has only %d channels", channel, len(regs.chip.channels))
+	return false
+}
+
 // WriteOperator は、オペレータレジスタに値を書き込みます。
 func (regs *Registers) WriteOperator(channel, operatorIndex int, offset ymf.OpRegister, v int) {
 	regs.chip.Mutex.Lock()
 	defer regs.chip.Mutex.Unlock()
+	if !regs.validChannel(channel) {
+		return
+	}
 	switch offset {
 	case ymf.EAM:
 		regs.chip.channels[channel].operators[operatorIndex].setEAM(v)
@@ -64,10 +77,14 @@ func (regs *Registers) WriteOperator(channel, operatorIndex int, offset ymf.OpRe
 func (regs *Registers) WriteTL(channel, operatorIndex int, tlCarrier, tlModulator int) {
 	regs.chip.Mutex.Lock()
 	defer regs.chip.Mutex.Unlock()
-	if regs.chip.channels[channel].operators[operatorIndex].isModulator {
-		regs.WriteOperator(channel, operatorIndex, ymf.TL, tlModulator)
+	if !regs.validChannel(channel) {
+		return
+	}
+	op := regs.chip.channels[channel].operators[operatorIndex]
+	if op.isModulator {
+		op.setTL(tlModulator)
 	} else {
-		regs.WriteOperator(channel, operatorIndex, ymf.TL, tlCarrier)
+		op.setTL(tlCarrier)
 	}
 }
 
@@ -75,13 +92,24 @@ func (regs *Registers) WriteTL(channel, operatorIndex int, tlCarrier, tlModulato
 func (regs *Registers) DebugSetMIDIChannel(channel, midiChannel int) {
 	regs.chip.Mutex.Lock()
 	defer regs.chip.Mutex.Unlock()
+	if !regs.validChannel(channel) {
+		return
+	}
 	regs.chip.channels[channel].midiChannelID = midiChannel
 }
 
+// ChannelCount は、音源チップが備えるチャンネル数を返します。
+func (regs *Registers) ChannelCount() int {
+	return regs.chip.ChannelCount()
+}
+
 // WriteChannel は、チャンネルレジスタに値を書き込みます。
 func (regs *Registers) WriteChannel(channel int, offset ymf.ChRegister, v int) {
 	regs.chip.Mutex.Lock()
 	defer regs.chip.Mutex.Unlock()
+	if !regs.validChannel(channel) {
+		return
+	}
 	switch offset {
 	case ymf.KON:
 		regs.chip.channels[channel].setKON(v)
@@ -105,6 +133,10 @@ func (regs *Registers) WriteChannel(channel int, offset ymf.ChRegister, v int) {
 		regs.chip.channels[channel].setVELOCITY(v)
 	case ymf.BO:
 		regs.chip.channels[channel].setBO(v)
+	case ymf.REVERB:
+		regs.chip.channels[channel].setSend(SendReverb, v)
+	case ymf.CHORUS:
+		regs.chip.channels[channel].setSend(SendChorus, v)
 	case ymf.RESET:
 		if v != 0 {
 			regs.chip.channels[channel].resetAll()
@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"math"
+)
+
+// resamplerZeroCrossings は、補間カーネルの片側に含まれる零交差の数です。
+const resamplerZeroCrossings = 16
+
+// resamplerPhases は、補間カーネルのテーブルにおける入力1サンプルあたりの分解能です。
+const resamplerPhases = 256
+
+// resampler は、窓関数付き sinc 補間で入力のサンプルレートを出力のサンプルレートに変換します。
+type resampler struct {
+	// step は、出力1サンプルあたりに進む入力のサンプル数です。
+	step float64
+	// frac は、次の出力サンプルの時刻の小数部です。
+	frac float64
+	// halfWidth は、補間カーネルの片側の幅 [入力サンプル数] です。
+	halfWidth int
+	// kernel は、補間カーネルの片側を resamplerPhases 倍の分解能でサンプリングしたテーブルです。
+	kernel []float64
+	// history は、左右それぞれの入力履歴です。連続したスライスとして参照できるよう2周分を保持します。
+	history [2][]float64
+	pos     int
+}
+
+func newResampler(inputRate, outputRate float64) *resampler {
+	step := inputRate / outputRate
+	// 出力のナイキスト周波数を超える成分は、入力のサンプルレートに対する比率で帯域制限する
+	cutoff := .5 * .95 * math.Min(1.0, 1.0/step)
+	halfWidth := int(math.Ceil(resamplerZeroCrossings * math.Max(1.0, step)))
+
+	r := &resampler{
+		step:      step,
+		halfWidth: halfWidth,
+		kernel:    make([]float64, halfWidth*resamplerPhases+2),
+	}
+	for i := range r.kernel {
+		x := float64(i) / resamplerPhases
+		if float64(halfWidth) <= x {
+			continue
+		}
+		sinc := 2.0 * cutoff
+		if x != .0 {
+			sinc = math.Sin(2.0*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		a := math.Pi * (x/float64(halfWidth) + 1.0)
+		window := .42 - .5*math.Cos(a) + .08*math.Cos(2.0*a)
+		r.kernel[i] = sinc * window
+	}
+	for i := range r.history {
+		r.history[i] = make([]float64, halfWidth*4)
+	}
+	return r
+}
+
+// inputsNeeded は、n サンプルを出力するために source から取得される入力のサンプル数を返します。
+func (r *resampler) inputsNeeded(n int) int {
+	result := 0
+	frac := r.frac
+	for i := 0; i < n; i++ {
+		for 1.0 <= frac {
+			result++
+			frac -= 1.0
+		}
+		frac += r.step
+	}
+	return result
+}
+
+func (r *resampler) push(l, rr float64) {
+	n := r.halfWidth * 2
+	r.history[0][r.pos] = l
+	r.history[0][r.pos+n] = l
+	r.history[1][r.pos] = rr
+	r.history[1][r.pos+n] = rr
+	r.pos = (r.pos + 1) % n
+}
+
+func (r *resampler) kernelAt(x float64) float64 {
+	x = math.Abs(x) * resamplerPhases
+	i := int(x)
+	if len(r.kernel)-1 <= i {
+		return .0
+	}
+	f := x - float64(i)
+	return r.kernel[i]*(1.0-f) + r.kernel[i+1]*f
+}
+
+// next は、必要に応じて source から入力を取得し、次の出力サンプルを返します。
+func (r *resampler) next(source func() (float64, float64)) (float64, float64) {
+	for 1.0 <= r.frac {
+		r.push(source())
+		r.frac -= 1.0
+	}
+
+	// 出力の時刻は、最も古い入力から数えて halfWidth-1+frac サンプル目
+	n := r.halfWidth * 2
+	histL := r.history[0][r.pos : r.pos+n]
+	histR := r.history[1][r.pos : r.pos+n]
+	t := float64(r.halfWidth-1) + r.frac
+	var l, rr float64
+	for j := 0; j < n; j++ {
+		k := r.kernelAt(t - float64(j))
+		l += histL[j] * k
+		rr += histR[j] * k
+	}
+
+	r.frac += r.step
+	return l, rr
+}
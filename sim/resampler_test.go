@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResampler(t *testing.T) {
+	// 入力の周波数 freq [Hz] に対する出力の振幅
+	measure := func(outputRate, freq float64) float64 {
+		r := newResampler(ymfdata.SampleRate, outputRate)
+		i := 0
+		source := func() (float64, float64) {
+			v := math.Cos(2.0 * math.Pi * freq * float64(i) / ymfdata.SampleRate)
+			i++
+			return v, -v
+		}
+		n := int(outputRate)
+		power := .0
+		for j := 0; j < n; j++ {
+			l, rr := r.next(source)
+			assert.Equal(t, l, -rr)
+			if n/2 <= j {
+				power += l * l
+			}
+		}
+		power /= float64(n - n/2)
+		if freq == .0 {
+			return math.Sqrt(power)
+		}
+		return math.Sqrt(power * 2.0)
+	}
+
+	for _, rate := range []float64{22050.0, 44100.0, 96000.0} {
+		assert.InDelta(t, 1.0, measure(rate, .0), .001, "rate=%f DC", rate)
+		assert.InDelta(t, 1.0, measure(rate, 1000.0), .01, "rate=%f passband", rate)
+	}
+	stopband := 20.0 * math.Log10(measure(22050.0, 15000.0))
+	assert.True(t, stopband < -40.0, "stopband=%fdB", stopband)
+}
@@ -0,0 +1,111 @@
+package sim
+
+// EnvelopeStage は、エンベロープの段階を表す列挙子型です。
+type EnvelopeStage int
+
+const (
+	// EnvelopeOff は、エンベロープが停止している段階を表す列挙子です。
+	EnvelopeOff = EnvelopeStage(stageOff)
+	// EnvelopeAttack は、アタックの段階を表す列挙子です。
+	EnvelopeAttack = EnvelopeStage(stageAttack)
+	// EnvelopeDecay は、ディケイの段階を表す列挙子です。
+	EnvelopeDecay = EnvelopeStage(stageDecay)
+	// EnvelopeSustain は、サステインの段階を表す列挙子です。
+	EnvelopeSustain = EnvelopeStage(stageSustain)
+	// EnvelopeRelease は、リリースの段階を表す列挙子です。
+	EnvelopeRelease = EnvelopeStage(stageRelease)
+)
+
+func (s EnvelopeStage) String() string {
+	return stage(s).String()
+}
+
+// OperatorSnapshot は、オペレータの状態のスナップショットです。
+type OperatorSnapshot struct {
+	// Modulator は、このオペレータがモジュレータとして使用されているかどうかです。
+	Modulator bool
+	// MULT は、MULT レジスタの値です。
+	MULT int
+	// WS は、WS レジスタの値です。
+	WS int
+	// AR, DR, SL, SR, RR は、エンベロープの各レジスタの値です。
+	AR, DR, SL, SR, RR int
+	// Stage は、エンベロープの段階です。
+	Stage EnvelopeStage
+	// Level は、エンベロープの現在のレベルです。TL および KSL による減衰は含まれません。
+	Level float64
+	// Output は、TL および KSL による減衰を含む現在の振幅の倍率です。
+	Output float64
+}
+
+// ChannelSnapshot は、チャンネルの状態のスナップショットです。
+type ChannelSnapshot struct {
+	// Channel は、チャンネル番号です。
+	Channel int
+	// MIDIChannel は、このチャンネルを使用しているMIDIチャンネル番号です。未使用時は -1 です。
+	MIDIChannel int
+	// Active は、このチャンネルが発音中であるかどうかです。
+	Active bool
+	// KeyOn は、キーオン中であるかどうかです。
+	KeyOn bool
+	// Algorithm は、ALG レジスタの値です。
+	Algorithm int
+	// FNUM, Block, BO は、周波数に関するレジスタの値です。
+	FNUM, Block, BO int
+	// Volume, Expression, Velocity は、音量に関するレジスタの値です。
+	Volume, Expression, Velocity int
+	// Panpot, ChPan は、パンに関するレジスタの値です。
+	Panpot, ChPan int
+	// Level は、キャリアの現在の振幅の倍率の最大値です。
+	Level float64
+	// Operators は、各オペレータの状態です。
+	Operators [4]OperatorSnapshot
+}
+
+// ChannelSnapshots は、全チャンネルの現在の状態を返します。
+func (chip *Chip) ChannelSnapshots() []ChannelSnapshot {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+
+	result := make([]ChannelSnapshot, len(chip.channels))
+	for i, ch := range chip.channels {
+		result[i] = ch.snapshot()
+	}
+	return result
+}
+
+func (ch *Channel) snapshot() ChannelSnapshot {
+	s := ChannelSnapshot{
+		Channel:     ch.channelID,
+		MIDIChannel: ch.midiChannelID,
+		Active:      ch.active && !ch.isOff(),
+		KeyOn:       ch.kon != 0,
+		Algorithm:   ch.alg,
+		FNUM:        ch.fnum,
+		Block:       ch.block,
+		BO:          ch.bo,
+		Volume:      ch.volume,
+		Expression:  ch.expression,
+		Velocity:    ch.velocity,
+		Panpot:      ch.panpot,
+		ChPan:       ch.chpan,
+		Level:       ch.currentLevel(),
+	}
+	for i, op := range ch.operators {
+		eg := op.envelopeGenerator
+		s.Operators[i] = OperatorSnapshot{
+			Modulator: op.isModulator,
+			MULT:      op.mult,
+			WS:        op.ws,
+			AR:        op.ar,
+			DR:        op.dr,
+			SL:        op.sl,
+			SR:        op.sr,
+			RR:        op.rr,
+			Stage:     EnvelopeStage(eg.stage),
+			Level:     eg.currentLevel,
+			Output:    eg.currentLevel * eg.kslTlCoef,
+		}
+	}
+	return s
+}
@@ -0,0 +1,372 @@
+package sim
+
+import (
+	"fmt"
+
+	"github.com/but80/fmfm.core/internal/binstate"
+	"github.com/but80/fmfm.core/ymf/ymfdata"
+)
+
+const (
+	chipStateMagic   = "fmfm.chip"
+	chipStateVersion = 5
+)
+
+// SaveState は、オペレータの位相、エンベロープの状態、LFO の位相、フィードバックの履歴、
+// リサンプラやデシメーションフィルタの履歴を含む、チップの演算状態をバイト列に直列化します。
+// サンプルレートやプロファイルなどの設定は含まれません。
+func (chip *Chip) SaveState() ([]byte, error) {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+
+	w := binstate.NewWriter(chipStateMagic, chipStateVersion)
+	w.Int(len(chip.channels))
+	w.Float64(chip.sampleRate)
+	w.Int(chip.oversampling)
+	w.Bool(chip.resampler != nil)
+
+	w.Uint64(chip.coreSamples)
+	w.Uint64(chip.egClocks)
+	w.Uint64(chip.egFrac)
+	for _, channel := range chip.channels {
+		channel.saveState(w)
+	}
+	for _, d := range chip.decimators {
+		if d != nil {
+			d.saveState(w)
+		}
+	}
+	if chip.resampler != nil {
+		chip.resampler.saveState(w)
+	}
+	return w.Bytes(), nil
+}
+
+// LoadState は、SaveState で直列化された状態を復元します。
+// チャンネル数、サンプルレート、オーバーサンプリングの倍率、リサンプラの有無は、
+// 直列化した時点のチップと一致している必要があります。
+func (chip *Chip) LoadState(data []byte) error {
+	chip.Mutex.Lock()
+	defer chip.Mutex.Unlock()
+
+	r, err := binstate.NewReader(data, chipStateMagic, chipStateVersion)
+	if err != nil {
+		return err
+	}
+	channels := r.Int()
+	sampleRate := r.Float64()
+	oversampling := r.Int()
+	resampled := r.Bool()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if channels != len(chip.channels) ||
+		sampleRate != chip.sampleRate ||
+		oversampling != chip.oversampling ||
+		resampled != (chip.resampler != nil) {
+		return fmt.Errorf(
+			"chip configuration mismatch: state has %d channels at %gHz (oversampling=%d, resampled=%v)",
+			channels, sampleRate, oversampling, resampled,
+		)
+	}
+
+	// 不完全な状態を残さないよう、新たに作成したチャンネルとフィルタに復元し、
+	// すべて正しく読み込めた場合にのみ置き換える
+	coreSamples := r.Uint64()
+	egClocks := r.Uint64()
+	egFrac := r.Uint64()
+	loaded := make([]*Channel, len(chip.channels))
+	for i := range loaded {
+		loaded[i] = newChannel(i, chip)
+		loaded[i].loadState(r)
+	}
+	var decimators [2]*decimator
+	for i, d := range chip.decimators {
+		if d != nil {
+			decimators[i] = newDecimator(chip.oversampling)
+			decimators[i].loadState(r)
+		}
+	}
+	var rs *resampler
+	if chip.resampler != nil {
+		rs = newResampler(ymfdata.SampleRate, chip.sampleRate)
+		rs.loadState(r)
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if 1<<32 <= egFrac {
+		return fmt.Errorf("invalid state of envelope clock")
+	}
+
+	chip.coreSamples = coreSamples
+	chip.egClocks = egClocks
+	chip.egFrac = egFrac
+	chip.channels = loaded
+	chip.decimators = decimators
+	chip.resampler = rs
+	// バスは、主出力のリサンプラの位相に揃えて作成し直す
+	chip.buses = nil
+	chip.activeChannels = chip.activeChannels[:0]
+	for _, channel := range chip.channels {
+		if channel.active {
+			chip.activeChannels = append(chip.activeChannels, channel)
+		}
+	}
+	return nil
+}
+
+func (ch *Channel) saveState(w *binstate.Writer) {
+	w.Int(ch.midiChannelID)
+	w.Int(ch.fnum)
+	w.Int(ch.kon)
+	w.Int(ch.block)
+	w.Int(ch.alg)
+	w.Int(ch.panpot)
+	w.Int(ch.chpan)
+	w.Int(ch.volume)
+	w.Int(ch.expression)
+	w.Int(ch.velocity)
+	w.Int(ch.bo)
+	for _, v := range ch.sends {
+		w.Int(v)
+	}
+	w.Int(ch.lfo)
+	w.Uint64(uint64(ch.modIndexFrac64))
+	w.Float64(ch.feedback1Prev)
+	w.Float64(ch.feedback1Curr)
+	w.Float64(ch.feedback3Prev)
+	w.Float64(ch.feedback3Curr)
+	w.Float64(ch.feedbackOut1)
+	w.Float64(ch.feedbackOut3)
+	w.Int32(ch.feedback1PrevInt)
+	w.Int32(ch.feedback1CurrInt)
+	w.Int32(ch.feedback3PrevInt)
+	w.Int32(ch.feedback3CurrInt)
+	w.Int32(ch.feedbackOut1Int)
+	w.Int32(ch.feedbackOut3Int)
+	w.Bool(ch.active)
+	w.Uint64(ch.idleSince)
+	for _, op := range ch.operators {
+		op.saveState(w)
+	}
+}
+
+func (ch *Channel) loadState(r *binstate.Reader) {
+	ch.midiChannelID = r.Int()
+	ch.fnum = r.Int()
+	ch.kon = r.Int()
+	ch.block = r.Int()
+	ch.alg = r.Int()
+	ch.panpot = r.Int()
+	ch.chpan = r.Int()
+	ch.volume = r.Int()
+	ch.expression = r.Int()
+	ch.velocity = r.Int()
+	ch.bo = r.Int()
+	for i := range ch.sends {
+		ch.sends[i] = r.Int()
+	}
+	ch.lfo = r.Int()
+	ch.modIndexFrac64 = ymfdata.Frac64(r.Uint64())
+	ch.feedback1Prev = r.Float64()
+	ch.feedback1Curr = r.Float64()
+	ch.feedback3Prev = r.Float64()
+	ch.feedback3Curr = r.Float64()
+	ch.feedbackOut1 = r.Float64()
+	ch.feedbackOut3 = r.Float64()
+	ch.feedback1PrevInt = r.Int32()
+	ch.feedback1CurrInt = r.Int32()
+	ch.feedback3PrevInt = r.Int32()
+	ch.feedback3CurrInt = r.Int32()
+	ch.feedbackOut1Int = r.Int32()
+	ch.feedbackOut3Int = r.Int32()
+	ch.active = r.Bool()
+	ch.idleSince = r.Uint64()
+	for _, op := range ch.operators {
+		op.loadState(r)
+	}
+	if r.Err() != nil {
+		return
+	}
+	if !inRange(ch.fnum, 1024) || !inRange(ch.block, 8) || !inRange(ch.bo, 4) ||
+		!inRange(ch.alg, len(ymfdata.CarrierMatrix)) ||
+		!inRange(ch.lfo, len(ymfdata.LFOFrequency)) ||
+		!inRange(ch.volume>>2, len(ymfdata.VolumeTable)) ||
+		!inRange(ch.expression>>2, len(ymfdata.VolumeTable)) ||
+		!inRange(ch.velocity>>2, len(ymfdata.VolumeTable)) {
+		r.Fail(fmt.Errorf("invalid state of channel %d", ch.channelID))
+		return
+	}
+	for i, v := range ch.sends {
+		if !inRange(v>>2, len(ymfdata.VolumeTable)) {
+			r.Fail(fmt.Errorf("invalid state of channel %d", ch.channelID))
+			return
+		}
+		ch.setSend(Send(i), v)
+	}
+	ch.updateLFOFrequency()
+	ch.updatePanCoef()
+	ch.updateAttenuation()
+}
+
+func (op *operator) saveState(w *binstate.Writer) {
+	w.Bool(op.isModulator)
+	w.Int(op.dt)
+	w.Int(op.ksr)
+	w.Int(op.mult)
+	w.Int(op.ksl)
+	w.Int(op.ar)
+	w.Int(op.dr)
+	w.Int(op.sl)
+	w.Int(op.sr)
+	w.Int(op.rr)
+	w.Int(op.xof)
+	w.Int(op.ws)
+	w.Int(op.fb)
+	w.Float64(op.feedbackCoef)
+	w.Int(op.keyScaleNumber)
+	w.Int(op.fnum)
+	w.Int(op.block)
+	w.Int(op.bo)
+
+	pg := op.phaseGenerator
+	w.Bool(pg.evb)
+	w.Int(pg.dvb)
+	w.Uint64(uint64(pg.phaseFrac64))
+	w.Uint64(uint64(pg.phaseIncrementFrac64))
+
+	eg := op.envelopeGenerator
+	w.Int(int(eg.stage))
+	w.Bool(eg.eam)
+	w.Int(eg.dam)
+	w.Float64(eg.arDiffPerSample)
+	w.Float64(eg.drCoefPerSample)
+	w.Float64(eg.srCoefPerSample)
+	w.Float64(eg.rrCoefPerSample)
+	w.Float64(eg.kslCoef)
+	w.Float64(eg.tlCoef)
+	w.Float64(eg.kslTlCoef)
+	w.Int(eg.kslSteps)
+	w.Int(eg.tlSteps)
+	w.Int(eg.kslTlSteps)
+	w.Float64(eg.sustainLevel)
+	w.Float64(eg.currentLevel)
+	w.Int(eg.attenuation)
+	w.Bool(eg.keyOnPending)
+}
+
+func (op *operator) loadState(r *binstate.Reader) {
+	op.isModulator = r.Bool()
+	op.dt = r.Int()
+	op.ksr = r.Int()
+	op.mult = r.Int()
+	op.ksl = r.Int()
+	op.ar = r.Int()
+	op.dr = r.Int()
+	op.sl = r.Int()
+	op.sr = r.Int()
+	op.rr = r.Int()
+	op.xof = r.Int()
+	op.ws = r.Int()
+	op.fb = r.Int()
+	op.feedbackCoef = r.Float64()
+	op.keyScaleNumber = r.Int()
+	op.fnum = r.Int()
+	op.block = r.Int()
+	op.bo = r.Int()
+
+	pg := op.phaseGenerator
+	pg.evb = r.Bool()
+	pg.dvb = r.Int()
+	pg.phaseFrac64 = ymfdata.Frac64(r.Uint64())
+	pg.phaseIncrementFrac64 = ymfdata.Frac64(r.Uint64())
+
+	eg := op.envelopeGenerator
+	eg.stage = stage(r.Int())
+	eg.eam = r.Bool()
+	eg.dam = r.Int()
+	eg.arDiffPerSample = r.Float64()
+	eg.drCoefPerSample = r.Float64()
+	eg.srCoefPerSample = r.Float64()
+	eg.rrCoefPerSample = r.Float64()
+	eg.kslCoef = r.Float64()
+	eg.tlCoef = r.Float64()
+	eg.kslTlCoef = r.Float64()
+	eg.kslSteps = r.Int()
+	eg.tlSteps = r.Int()
+	eg.kslTlSteps = r.Int()
+	eg.sustainLevel = r.Float64()
+	eg.currentLevel = r.Float64()
+	eg.attenuation = r.Int()
+	eg.keyOnPending = r.Bool()
+
+	if r.Err() != nil {
+		return
+	}
+	// テーブルの添字、シフト量、状態として使用する値はすべて検証する
+	if !inRange(op.dt, len(ymfdata.DTCoef)) ||
+		!inRange(op.ksr, len(attackTimeSecAt1)) ||
+		!inRange(op.mult, len(ymfdata.MultTable2)) ||
+		!inRange(op.ksl, len(ymfdata.KSLTable)) ||
+		!inRange(op.ar, 16) || !inRange(op.dr, 16) || !inRange(op.sl, 16) ||
+		!inRange(op.sr, 16) || !inRange(op.rr, 16) ||
+		!inRange(op.ws, len(ymfdata.Waveforms)) ||
+		!inRange(op.fb, len(ymfdata.FeedbackTable)) ||
+		!inRange(op.keyScaleNumber, 16) ||
+		!inRange(op.fnum, 1024) || !inRange(op.block, 8) || !inRange(op.bo, 4) ||
+		!inRange(pg.dvb, 4) ||
+		!inRange(int(eg.stage), int(stageRelease)+1) ||
+		!inRange(eg.dam, 4) ||
+		!inRange(eg.kslSteps, ymfdata.EnvelopeStepMax+1) ||
+		!inRange(eg.tlSteps, ymfdata.EnvelopeStepMax+1) ||
+		!inRange(eg.kslTlSteps, 2*ymfdata.EnvelopeStepMax+1) ||
+		!inRange(eg.attenuation, ymfdata.EnvelopeStepMax+1) {
+		r.Fail(fmt.Errorf("invalid state of operator %d-%d", op.channelID, op.operatorIndex))
+		return
+	}
+	op.updateWaveform()
+	op.updateEnvelope()
+	eg.setActualSustainLevel(op.sl)
+}
+
+// inRange は、v が 0 以上 n 未満であるかどうかを返します。
+func inRange(v, n int) bool {
+	return 0 <= v && v < n
+}
+
+func (d *decimator) saveState(w *binstate.Writer) {
+	w.Int(d.pos)
+	for _, history := range d.history {
+		w.Float64s(history)
+	}
+}
+
+func (d *decimator) loadState(r *binstate.Reader) {
+	d.pos = r.Int()
+	for _, history := range d.history {
+		r.Float64s(history)
+	}
+	if d.pos < 0 || decimatorTapsPerPhase <= d.pos {
+		r.Fail(fmt.Errorf("invalid state of decimator"))
+	}
+}
+
+func (r *resampler) saveState(w *binstate.Writer) {
+	w.Float64(r.frac)
+	w.Int(r.pos)
+	for _, history := range r.history {
+		w.Float64s(history)
+	}
+}
+
+func (r *resampler) loadState(sr *binstate.Reader) {
+	r.frac = sr.Float64()
+	r.pos = sr.Int()
+	for _, history := range r.history {
+		sr.Float64s(history)
+	}
+	if r.pos < 0 || r.halfWidth*2 <= r.pos {
+		sr.Fail(fmt.Errorf("invalid state of resampler"))
+	}
+}
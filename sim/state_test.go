@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/but80/fmfm.core/ymf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChip_LoadState_invalid(t *testing.T) {
+	for _, corrupt := range []func(chip *Chip){
+		func(chip *Chip) { chip.channels[0].operators[1].ksl = 9 },
+		func(chip *Chip) { chip.channels[0].operators[1].ksr = 7 },
+		func(chip *Chip) { chip.channels[0].operators[2].mult = 16 },
+		func(chip *Chip) { chip.channels[0].operators[3].dt = -1 },
+		func(chip *Chip) { chip.channels[0].operators[0].ar = 16 },
+		func(chip *Chip) { chip.channels[0].operators[0].keyScaleNumber = 16 },
+		func(chip *Chip) { chip.channels[0].operators[0].envelopeGenerator.stage = stageRelease + 1 },
+		func(chip *Chip) { chip.channels[1].block = 8 },
+		func(chip *Chip) { chip.channels[1].fnum = 1024 },
+	} {
+		src := NewChip(48000.0, -15.0, -1, nil)
+		corrupt(src)
+		state, err := src.SaveState()
+		assert.NoError(t, err)
+
+		chip := NewChip(48000.0, -15.0, -1, nil)
+		assert.Error(t, chip.LoadState(state))
+
+		// 読み込みに失敗したチップへのレジスタの書き込みが、範囲外の値を参照しない
+		regs := NewRegisters(chip)
+		assert.NotPanics(t, func() {
+			for ch := 0; ch < 2; ch++ {
+				regs.WriteChannel(ch, ymf.FNUM, 0x200)
+				regs.WriteChannel(ch, ymf.BLOCK, 4)
+				regs.WriteChannel(ch, ymf.KON, 1)
+			}
+			for i := 0; i < 100; i++ {
+				chip.Next()
+			}
+		})
+	}
+}
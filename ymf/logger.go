@@ -0,0 +1,22 @@
+package ymf
+
+import (
+	"log"
+	"os"
+)
+
+// Logger は、音源チップやコントローラが動作状況を出力するためのインタフェースです。
+// *log.Logger はこのインタフェースを満たします。
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// DefaultLogger は、Logger が指定されていない場合に使用される、標準出力に表示する Logger です。
+var DefaultLogger Logger = log.New(os.Stdout, "", 0)
+
+// NopLogger は、何も出力しない Logger です。
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
@@ -0,0 +1,70 @@
+package ymf
+
+// MultiRegisters は、複数の音源チップのレジスタを、通し番号のチャンネルで扱う Registers です。
+// 各チップのチャンネルは、渡された順に連続したチャンネル番号に割り当てられます。
+type MultiRegisters struct {
+	registers []Registers
+	chips     []int
+	locals    []int
+}
+
+var _ Registers = &MultiRegisters{}
+
+// NewMultiRegisters は、新しい MultiRegisters を作成します。
+func NewMultiRegisters(registers ...Registers) *MultiRegisters {
+	m := &MultiRegisters{
+		registers: registers,
+		chips:     []int{},
+		locals:    []int{},
+	}
+	for i, regs := range registers {
+		for j := 0; j < regs.ChannelCount(); j++ {
+			m.chips = append(m.chips, i)
+			m.locals = append(m.locals, j)
+		}
+	}
+	return m
+}
+
+// ChipCount は、音源チップの数を返します。
+func (m *MultiRegisters) ChipCount() int {
+	return len(m.registers)
+}
+
+// ChipIndex は、指定チャンネルを備える音源チップの番号を返します。
+func (m *MultiRegisters) ChipIndex(channel int) int {
+	return m.chips[channel]
+}
+
+func (m *MultiRegisters) locate(channel int) (Registers, int) {
+	return m.registers[m.chips[channel]], m.locals[channel]
+}
+
+// WriteOperator は、オペレータレジスタに値を書き込みます。
+func (m *MultiRegisters) WriteOperator(channel, operatorIndex int, offset OpRegister, v int) {
+	regs, ch := m.locate(channel)
+	regs.WriteOperator(ch, operatorIndex, offset, v)
+}
+
+// WriteTL は、TLレジスタに値を書き込みます。
+func (m *MultiRegisters) WriteTL(channel, operatorIndex int, tlCarrier, tlModulator int) {
+	regs, ch := m.locate(channel)
+	regs.WriteTL(ch, operatorIndex, tlCarrier, tlModulator)
+}
+
+// WriteChannel は、チャンネルレジスタに値を書き込みます。
+func (m *MultiRegisters) WriteChannel(channel int, offset ChRegister, v int) {
+	regs, ch := m.locate(channel)
+	regs.WriteChannel(ch, offset, v)
+}
+
+// DebugSetMIDIChannel は、チャンネルを使用しているMIDIチャンネル番号をデバッグ用にセットします。
+func (m *MultiRegisters) DebugSetMIDIChannel(channel, midiChannel int) {
+	regs, ch := m.locate(channel)
+	regs.DebugSetMIDIChannel(ch, midiChannel)
+}
+
+// ChannelCount は、全音源チップのチャンネル数の合計を返します。
+func (m *MultiRegisters) ChannelCount() int {
+	return len(m.chips)
+}
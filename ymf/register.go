@@ -68,6 +68,10 @@ const (
 	BO
 	// RESET は、RESET レジスタです。
 	RESET
+	// REVERB は、リバーブへのセンド量を保持するレジスタです。実チップには存在しません。
+	REVERB
+	// CHORUS は、コーラスへのセンド量を保持するレジスタです。実チップには存在しません。
+	CHORUS
 )
 
 // Registers は、音源チップのレジスタを抽象化したインタフェースです。
@@ -80,4 +84,6 @@ type Registers interface {
 	WriteChannel(channel int, offset ChRegister, v int)
 	// DebugSetMIDIChannel は、チャンネルを使用しているMIDIチャンネル番号をデバッグ用にセットします。
 	DebugSetMIDIChannel(channel, midiChannel int)
+	// ChannelCount は、音源チップが備えるチャンネル数を返します。
+	ChannelCount() int
 }
@@ -0,0 +1,98 @@
+package ymfdata
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+// BandLimitedLevels は、帯域制限された波形テーブルの段数です。
+// level 段目のテーブルは、(WaveformLen/2)>>level 次までの倍音のみを含みます。
+const BandLimitedLevels = WaveformLenBits
+
+var (
+	bandLimitedOnce      sync.Once
+	bandLimitedWaveforms [32][BandLimitedLevels][]float64
+)
+
+// BandLimitedWaveforms は、Waveforms を1オクターブごとに帯域制限した波形テーブルを返します。
+// テーブルは初回の呼び出し時に生成されます。
+func BandLimitedWaveforms() *[32][BandLimitedLevels][]float64 {
+	bandLimitedOnce.Do(generateBandLimitedWaveforms)
+	return &bandLimitedWaveforms
+}
+
+// BandLimitedLevel は、1サンプルあたりの位相の増分から、
+// 折り返しを生じない最も倍音の多いテーブルの段を返します。
+func BandLimitedLevel(phaseIncrement Frac64) int {
+	inc := float64(phaseIncrement) / Pow64Of2
+	maxHarmonic := WaveformLen / 2
+	if inc <= .0 {
+		return 0
+	}
+	limit := .5 / inc
+	level := 0
+	for level < BandLimitedLevels-1 && limit < float64(maxHarmonic>>uint(level)) {
+		level++
+	}
+	return level
+}
+
+func generateBandLimitedWaveforms() {
+	for ws, wave := range Waveforms {
+		spectrum := make([]complex128, WaveformLen)
+		for i, v := range wave {
+			spectrum[i] = complex(v, 0)
+		}
+		fft(spectrum, false)
+
+		for level := 0; level < BandLimitedLevels; level++ {
+			maxHarmonic := (WaveformLen / 2) >> uint(level)
+			buf := make([]complex128, WaveformLen)
+			for k := range buf {
+				if k <= maxHarmonic || WaveformLen-maxHarmonic <= k {
+					buf[k] = spectrum[k]
+				}
+			}
+			fft(buf, true)
+			table := make([]float64, WaveformLen)
+			for i, v := range buf {
+				table[i] = real(v) / WaveformLen
+			}
+			bandLimitedWaveforms[ws][level] = table
+		}
+	}
+}
+
+// fft は、長さが2のべき乗の系列に対して高速フーリエ変換をその場で行います。
+// inverse が true の場合は逆変換を行います（1/N の正規化は行いません）。
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Rect(1.0, sign*2.0*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			wk := complex(1.0, .0)
+			for k := 0; k < size/2; k++ {
+				a := x[start+k]
+				b := x[start+k+size/2] * wk
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wk *= w
+			}
+		}
+	}
+}
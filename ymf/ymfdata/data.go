@@ -28,7 +28,8 @@ type Int32Frac32 uint64
 // DebugDumpFPS は、デバッグとしてダンプ表示を行う頻度 [FPS] です。
 const DebugDumpFPS = 30
 
-// ChannelCount は、最大チャンネル数です。
+// ChannelCount は、音源チップが備えるチャンネル数の最大値です。
+// 実際のチャンネル数は ymf.Registers の ChannelCount で取得します。
 const ChannelCount = 32
 
 // SampleRate は、内部的なサンプルレート[Hz]です。
@@ -124,6 +125,14 @@ var VibratoTableInt32Frac32 [4][ModTableLen]Int32Frac32
 // TremoloTable は、トレモロ（DAM）によって振幅にかかる係数のテーブルです。
 var TremoloTable [4][ModTableLen]float64
 
+// VibratoDepth は、DVBパラメータによるビブラートの深さ[cent]です。
+// https://github.com/yamaha-webmusic/ymf825board/blob/991485a4cbbe07d84cca707701999875fbc17c74/manual/fbd_spec3.md#dam-eam-dvb-evb
+var VibratoDepth = [4]float64{3.4, 6.7, 13.5, 26.8}
+
+// TremoloDepth は、DAMパラメータによるトレモロの深さ[dB]です。
+// https://github.com/yamaha-webmusic/ymf825board/blob/991485a4cbbe07d84cca707701999875fbc17c74/manual/fbd_spec3.md#dam-eam-dvb-evb
+var TremoloDepth = [4]float64{1.3, 2.8, 5.8, 11.8}
+
 // FeedbackTable は、FBパラメータによってフィードバックされる信号の振幅にかかる係数のテーブルです。
 var FeedbackTable = [8]float64{0, 1.0 / 32.0, 1.0 / 16.0, 1.0 / 8.0, 1.0 / 4.0, 1.0 / 2.0, 1.0, 2.0}
 
@@ -152,7 +161,8 @@ func calculateIncrement(begin, end, period float64) float64 {
 	return (end - begin) / SampleRate * (1.0 / period)
 }
 
-func triSin(phase float64) float64 {
+// TriSin は、位相 phase (0..1) における、正弦波と同位相の三角波の値を返します。
+func TriSin(phase float64) float64 {
 	phase *= 4.0
 	if phase < 1.0 {
 		return phase
@@ -163,7 +173,8 @@ func triSin(phase float64) float64 {
 	return phase - 4.0
 }
 
-func triCos(phase float64) float64 {
+// TriCos は、位相 phase (0..1) における、余弦波と同位相の三角波の値を返します。
+func TriCos(phase float64) float64 {
 	phase *= 4.0
 	if phase < 2.0 {
 		return 1.0 - phase
@@ -171,6 +182,43 @@ func triCos(phase float64) float64 {
 	return phase - 3.0
 }
 
+func modTablePhase(i, steps int) float64 {
+	phase := float64(i) / float64(ModTableLen)
+	if 0 < steps {
+		phase = math.Floor(phase*float64(steps)) / float64(steps)
+	}
+	return phase
+}
+
+// GenerateVibratoTable は、ビブラートの深さ[cent]とLFO波形から、
+// VibratoTableInt32Frac32 と同じ形式のテーブルを生成します。
+// steps が正の場合、LFOの1周期を steps 段階に量子化します。
+func GenerateVibratoTable(depth [4]float64, wave func(phase float64) float64, steps int) *[4][ModTableLen]Int32Frac32 {
+	result := &[4][ModTableLen]Int32Frac32{}
+	for dvb := 0; dvb < 4; dvb++ {
+		for i := 0; i < ModTableLen; i++ {
+			cent := wave(modTablePhase(i, steps)) * depth[dvb]
+			v := math.Pow(2.0, cent/1200.0)
+			result[dvb][i] = Int32Frac32(v * Pow32Of2)
+		}
+	}
+	return result
+}
+
+// GenerateTremoloTable は、トレモロの深さ[dB]とLFO波形から、
+// TremoloTable と同じ形式のテーブルを生成します。
+// steps が正の場合、LFOの1周期を steps 段階に量子化します。
+func GenerateTremoloTable(depth [4]float64, wave func(phase float64) float64, steps int) *[4][ModTableLen]float64 {
+	result := &[4][ModTableLen]float64{}
+	for dam := 0; dam < 4; dam++ {
+		for i := 0; i < ModTableLen; i++ {
+			v := (wave(modTablePhase(i, steps)) - 1.0) * .5 * depth[dam]
+			result[dam][i] = math.Pow(10.0, v/20.0)
+		}
+	}
+	return result
+}
+
 func init() {
 	// generate volume table
 	for i := range VolumeTable {
@@ -186,27 +234,10 @@ func init() {
 	}
 
 	// generate vibrato table
-	// https://github.com/yamaha-webmusic/ymf825board/blob/991485a4cbbe07d84cca707701999875fbc17c74/manual/fbd_spec3.md#dam-eam-dvb-evb
-	vibratoDepth := [4]float64{3.4, 6.7, 13.5, 26.8}
-	for dvb := 0; dvb < 4; dvb++ {
-		for i := 0; i < ModTableLen; i++ {
-			phase := float64(i) / float64(ModTableLen)
-			cent := triSin(phase) * vibratoDepth[dvb]
-			v := math.Pow(2.0, cent/1200.0)
-			VibratoTableInt32Frac32[dvb][i] = Int32Frac32(v * Pow32Of2)
-		}
-	}
+	VibratoTableInt32Frac32 = *GenerateVibratoTable(VibratoDepth, TriSin, 0)
 
 	// generate tremolo table
-	// https://github.com/yamaha-webmusic/ymf825board/blob/991485a4cbbe07d84cca707701999875fbc17c74/manual/fbd_spec3.md#dam-eam-dvb-evb
-	tremoloDepth := [4]float64{1.3, 2.8, 5.8, 11.8} // dB
-	for dam := 0; dam < 4; dam++ {
-		for i := 0; i < ModTableLen; i++ {
-			phase := float64(i) / float64(ModTableLen)
-			v := (triCos(phase) - 1.0) * .5 * tremoloDepth[dam]
-			TremoloTable[dam][i] = math.Pow(10.0, v/20.0)
-		}
-	}
+	TremoloTable = *GenerateTremoloTable(TremoloDepth, TriCos, 0)
 
 	// generate KSL table
 	kslBases := [4]float64{.0, .08, 1.0 / 15.0, 1.0 / 15.0}
@@ -409,4 +440,5 @@ func init() {
 
 	}
 
+	initLogTables()
 }
@@ -0,0 +1,185 @@
+package ymfdata
+
+import (
+	"math"
+)
+
+// LogUnitDB は、対数領域における減衰量 1 単位あたりの dB 値です。
+// 1 単位は 1/256 オクターブ（約 0.0235dB）です。
+const LogUnitDB = 6.020599913279624 / 256.0
+
+// LogSignBit は、LogWaveforms の値における符号ビットです。
+const LogSignBit = 0x8000
+
+// LogAttenuationMax は、対数領域の減衰量の最大値です。これ以上の減衰は無音として扱います。
+const LogAttenuationMax = 0x1fff
+
+// EnvelopeStepDB は、エンベロープ減衰量 1 ステップあたりの dB 値です。
+const EnvelopeStepDB = 0.1875
+
+// EnvelopeStepMax は、エンベロープ減衰量の最大ステップ数です。
+const EnvelopeStepMax = 511
+
+// EnvelopeStepShift は、エンベロープ減衰量のステップ数を対数領域の単位に変換する際、
+// 左シフトするビット数です。
+const EnvelopeStepShift = 3
+
+// IntFullScale は、整数コアにおけるオペレータ出力の振幅 1.0 に相当する値です。
+// モジュレータの出力はそのまま10bitの位相に加算されるため、
+// ModulatorMultiplier 倍した浮動小数点コアの変調量と一致します。
+const IntFullScale = 4096
+
+// LogWaveforms は、波形テーブルを対数領域で表したものです。
+// WS 0〜7 は、OPL系列のチップと同じ手順で LogSinTable から生成します。
+// WS 8 以降は対応するROMの手順が知られていないため、Waveforms の各値を LinearToLog で変換して生成します。
+// 各値の下位13bitは1/256オクターブ単位の減衰量、最上位ビットは符号です。
+var LogWaveforms [32][]uint16
+
+// LogSinTable は、サイン波の1/4周期を256分割し、各点の振幅を対数領域の減衰量で表したテーブルです。
+// YMF262 のダイから読み出されたROMと同じ値です。
+var LogSinTable [256]uint16
+
+// ExpTable は、対数領域の減衰量の下位8bitから振幅を得る指数テーブルです。
+// YMF262 のダイから読み出されたROMと同じ値で、LogToLinear で1bit左シフトし、
+// 減衰量の上位ビットの分だけ右シフトして使用します。
+var ExpTable [256]uint16
+
+// KSLTableROM は、FNUM上位4bitに対するキースケーリングの減衰量のテーブルです。
+// YMF262 のダイから読み出されたROMと同じ値で、単位はエンベロープ減衰量の4ステップです。
+var KSLTableROM = [16]int{0, 32, 40, 45, 48, 51, 53, 55, 56, 58, 59, 60, 61, 62, 63, 64}
+
+// TremoloStepTable は、トレモロ（DAM）によるエンベロープ減衰量のステップ数のテーブルです。
+var TremoloStepTable [4][ModTableLen]int
+
+// LinearToLog は、振幅の絶対値を対数領域の減衰量に変換します。
+func LinearToLog(v float64) int {
+	v = math.Abs(v)
+	if v <= .0 {
+		return LogAttenuationMax
+	}
+	att := int(math.Floor(-math.Log2(v)*256.0 + .5))
+	if att < 0 {
+		return 0
+	} else if LogAttenuationMax < att {
+		return LogAttenuationMax
+	}
+	return att
+}
+
+// CoefToEnvelopeSteps は、振幅にかかる係数をエンベロープ減衰量のステップ数に変換します。
+func CoefToEnvelopeSteps(coef float64) int {
+	if coef <= .0 {
+		return EnvelopeStepMax
+	}
+	steps := int(math.Floor(-20.0*math.Log10(coef)/EnvelopeStepDB + .5))
+	if steps < 0 {
+		return 0
+	} else if EnvelopeStepMax < steps {
+		return EnvelopeStepMax
+	}
+	return steps
+}
+
+// LogToLinear は、対数領域の減衰量を整数の振幅に変換します。
+func LogToLinear(att int) int32 {
+	if LogAttenuationMax < att {
+		att = LogAttenuationMax
+	}
+	return int32(ExpTable[att&0xff]) << 1 >> uint(att>>8)
+}
+
+// logSinWaveform は、OPL系列のチップと同じ手順で、WS 0〜7 の10bitの位相における対数領域の値を返します。
+func logSinWaveform(ws, phase int) uint16 {
+	const silent = 0x1000
+	var att, sign uint16
+	sin := func(i int) uint16 {
+		if i&0x100 != 0 {
+			return LogSinTable[(i&0xff)^0xff]
+		}
+		return LogSinTable[i&0xff]
+	}
+	switch ws {
+	case 0:
+		att = sin(phase)
+		if phase&0x200 != 0 {
+			sign = LogSignBit
+		}
+	case 1:
+		att = sin(phase)
+		if phase&0x200 != 0 {
+			att = silent
+		}
+	case 2:
+		att = sin(phase)
+	case 3:
+		att = LogSinTable[phase&0xff]
+		if phase&0x100 != 0 {
+			att = silent
+		}
+	case 4, 5:
+		// 2倍の速度で1周期を読む
+		if phase&0x200 != 0 {
+			att = silent
+		} else if phase&0x80 != 0 {
+			att = LogSinTable[(phase^0xff)<<1&0xff]
+		} else {
+			att = LogSinTable[phase<<1&0xff]
+		}
+		if ws == 4 && phase&0x300 == 0x100 {
+			sign = LogSignBit
+		}
+	case 6:
+		if phase&0x200 != 0 {
+			sign = LogSignBit
+		}
+	case 7:
+		if phase&0x200 != 0 {
+			phase = phase&0x1ff ^ 0x1ff
+			sign = LogSignBit
+		}
+		att = uint16(phase << 3)
+	}
+	return att | sign
+}
+
+func initLogTables() {
+	// generate log-sin and exp tables
+	for i := range LogSinTable {
+		v := -math.Log2(math.Sin((float64(i) + .5) * math.Pi / 512.0))
+		LogSinTable[i] = uint16(math.Floor(v*256.0 + .5))
+	}
+	for i := range ExpTable {
+		ExpTable[i] = uint16(math.Floor(math.Pow(2.0, float64(255-i)/256.0)*1024.0 + .5))
+	}
+
+	// generate log waveform table
+	for ws, wave := range Waveforms {
+		LogWaveforms[ws] = make([]uint16, WaveformLen)
+		for i, v := range wave {
+			if ws < 8 {
+				LogWaveforms[ws][i] = logSinWaveform(ws, i)
+				continue
+			}
+			att := uint16(LinearToLog(v))
+			if v < .0 {
+				att |= LogSignBit
+			}
+			LogWaveforms[ws][i] = att
+		}
+	}
+
+	// generate tremolo step table
+	TremoloStepTable = *GenerateTremoloStepTable(&TremoloTable)
+}
+
+// GenerateTremoloStepTable は、TremoloTable と同じ形式のテーブルから
+// TremoloStepTable と同じ形式のテーブルを生成します。
+func GenerateTremoloStepTable(tremoloTable *[4][ModTableLen]float64) *[4][ModTableLen]int {
+	result := &[4][ModTableLen]int{}
+	for dam := 0; dam < 4; dam++ {
+		for i := 0; i < ModTableLen; i++ {
+			result[dam][i] = CoefToEnvelopeSteps(tremoloTable[dam][i])
+		}
+	}
+	return result
+}
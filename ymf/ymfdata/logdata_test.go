@@ -0,0 +1,60 @@
+package ymfdata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSinTable(t *testing.T) {
+	// YMF262 のダイから読み出されたROMの先頭と末尾の値
+	head := []uint16{
+		0x859, 0x6c3, 0x607, 0x58b, 0x52e, 0x4e4, 0x4a6, 0x471,
+		0x443, 0x41a, 0x3f5, 0x3d3, 0x3b5, 0x398, 0x37e, 0x365,
+	}
+	assert.Equal(t, head, LogSinTable[:16])
+	tail := []uint16{0x2, 0x2, 0x2, 0x2, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+	assert.Equal(t, tail, LogSinTable[237:])
+}
+
+func TestExpTable(t *testing.T) {
+	head := []uint16{
+		0x7fa, 0x7f5, 0x7ef, 0x7ea, 0x7e4, 0x7df, 0x7da, 0x7d4,
+		0x7cf, 0x7c9, 0x7c4, 0x7bf, 0x7b9, 0x7b4, 0x7ae, 0x7a9,
+	}
+	assert.Equal(t, head, ExpTable[:16])
+	tail := []uint16{0x414, 0x411, 0x40e, 0x40b, 0x408, 0x406, 0x403, 0x400}
+	assert.Equal(t, tail, ExpTable[248:])
+}
+
+func TestLogToLinear(t *testing.T) {
+	assert.Equal(t, int32(4084), LogToLinear(0))
+	assert.Equal(t, int32(3998), LogToLinear(8))
+	assert.Equal(t, int32(2042), LogToLinear(0x100))
+	assert.Equal(t, int32(0), LogToLinear(0x1000))
+	assert.Equal(t, int32(0), LogToLinear(LogAttenuationMax))
+	assert.Equal(t, int32(0), LogToLinear(LogAttenuationMax+1))
+}
+
+func TestLogWaveforms(t *testing.T) {
+	assert.Equal(t, uint16(0x859), LogWaveforms[0][0])
+	assert.Equal(t, uint16(0), LogWaveforms[0][0x100])
+	assert.Equal(t, uint16(LogSignBit), LogWaveforms[0][0x300])
+	assert.Equal(t, uint16(0x1000), LogWaveforms[1][0x300])
+	assert.Equal(t, uint16(0), LogWaveforms[2][0x300])
+	assert.Equal(t, uint16(0x1000), LogWaveforms[3][0x100])
+	assert.Equal(t, uint16(LogSignBit), LogWaveforms[4][0x180])
+	assert.Equal(t, uint16(0), LogWaveforms[5][0x180])
+	assert.Equal(t, uint16(LogSignBit), LogWaveforms[6][0x200])
+	assert.Equal(t, uint16(8), LogWaveforms[7][1])
+	assert.Equal(t, uint16(LogSignBit), LogWaveforms[7][0x3ff])
+
+	// ROMから生成した波形の符号は、浮動小数点数の波形テーブルと一致する
+	for ws := 0; ws < 8; ws++ {
+		for i, v := range Waveforms[ws] {
+			if LogWaveforms[ws][i]&^LogSignBit < 0x1000 && 1e-3 < v*v {
+				assert.Equal(t, v < 0, LogWaveforms[ws][i]&LogSignBit != 0, "ws=%d i=%d", ws, i)
+			}
+		}
+	}
+}